@@ -0,0 +1,426 @@
+// Copyright 2017 Łukasz Pankowski <lukpank at o2 dot pl>. All rights
+// reserved.  This source code is licensed under the terms of the MIT
+// license. See LICENSE file for details.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type kind int
+
+const (
+	kindString kind = iota
+	kindBool
+	kindInt
+	kindUint
+	kindFloat
+	kindStruct
+	kindTime
+	kindSlice
+	kindPointer
+)
+
+// typeInfo describes a supported Go field type in terms the generator
+// knows how to read and write with a jsonlexer.Lexer.
+type typeInfo struct {
+	Kind    kind
+	GoType  string // textual Go type, e.g. "int32", "*Foo", "[]Bar"
+	Elem    *typeInfo
+	Layout  string // time.Time layout, only set for Kind == kindTime
+	Float32 bool   // Kind == kindFloat and the field is a float32
+}
+
+type field struct {
+	GoName   string
+	JSONName string
+	Type     typeInfo
+}
+
+type structType struct {
+	Name   string
+	Fields []field
+}
+
+// Generate parses the Go package in dir and emits Unmarshal/MarshalJSONLexer
+// methods for the named struct types. outputFile is the path Generate's
+// result is destined to be written to (as produced by filepath.Join(dir,
+// ...)); it is used only to recognize the package's own prior output
+// when deciding whether the jsonlexergenWrite* helpers (see
+// renderHelpers) still need emitting, so that running the generator
+// more than once per package doesn't redeclare them.
+func Generate(dir string, typeNames []string, outputFile string) ([]byte, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("no Go package found in %s", dir)
+	}
+	var pkgName string
+	specs := map[string]*ast.StructType{}
+	haveHelpers := false
+	for name, pkg := range pkgs {
+		pkgName = name
+		for filename, f := range pkg.Files {
+			for _, decl := range f.Decls {
+				if filename != outputFile {
+					if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv == nil && isHelperFuncName(fd.Name.Name) {
+						haveHelpers = true
+					}
+				}
+				gd, ok := decl.(*ast.GenDecl)
+				if !ok || gd.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gd.Specs {
+					ts, ok := spec.(*ast.TypeSpec)
+					if !ok {
+						continue
+					}
+					if st, ok := ts.Type.(*ast.StructType); ok {
+						specs[ts.Name.Name] = st
+					}
+				}
+			}
+		}
+	}
+
+	var structs []structType
+	for _, name := range typeNames {
+		name = strings.TrimSpace(name)
+		st, ok := specs[name]
+		if !ok {
+			return nil, fmt.Errorf("struct type %q not found in %s", name, dir)
+		}
+		s, err := buildStruct(name, st)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		structs = append(structs, s)
+	}
+
+	src := render(pkgName, structs, !haveHelpers)
+	out, err := format.Source(src)
+	if err != nil {
+		return src, fmt.Errorf("generated invalid Go source: %v", err)
+	}
+	return out, nil
+}
+
+func buildStruct(name string, st *ast.StructType) (structType, error) {
+	s := structType{Name: name}
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 {
+			return s, fmt.Errorf("embedded fields are not supported (in %s)", name)
+		}
+		goName := f.Names[0].Name
+		if !ast.IsExported(goName) {
+			continue
+		}
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			unquoted, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return s, err
+			}
+			tag = reflect.StructTag(unquoted)
+		}
+		jsonName := goName
+		layout := "2006-01-02T15:04:05Z07:00"
+		if j := tag.Get("json"); j != "" {
+			parts := strings.Split(j, ",")
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				jsonName = parts[0]
+			}
+		}
+		if l := tag.Get("layout"); l != "" {
+			layout = l
+		}
+		t, err := typeInfoFromExpr(f.Type, layout)
+		if err != nil {
+			return s, fmt.Errorf("field %s: %v", goName, err)
+		}
+		s.Fields = append(s.Fields, field{GoName: goName, JSONName: jsonName, Type: t})
+	}
+	return s, nil
+}
+
+func typeInfoFromExpr(expr ast.Expr, layout string) (typeInfo, error) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		switch e.Name {
+		case "string":
+			return typeInfo{Kind: kindString, GoType: "string"}, nil
+		case "bool":
+			return typeInfo{Kind: kindBool, GoType: "bool"}, nil
+		case "int", "int8", "int16", "int32", "int64":
+			return typeInfo{Kind: kindInt, GoType: e.Name}, nil
+		case "uint", "uint8", "uint16", "uint32", "uint64":
+			return typeInfo{Kind: kindUint, GoType: e.Name}, nil
+		case "float64":
+			return typeInfo{Kind: kindFloat, GoType: "float64"}, nil
+		case "float32":
+			return typeInfo{Kind: kindFloat, GoType: "float32", Float32: true}, nil
+		default:
+			// Assume a named struct type in the same package, with its
+			// own (hand-written or generated) UnmarshalJSONLexer and
+			// MarshalJSONLexer methods.
+			return typeInfo{Kind: kindStruct, GoType: e.Name}, nil
+		}
+	case *ast.StarExpr:
+		elem, err := typeInfoFromExpr(e.X, layout)
+		if err != nil {
+			return typeInfo{}, err
+		}
+		return typeInfo{Kind: kindPointer, GoType: "*" + elem.GoType, Elem: &elem}, nil
+	case *ast.ArrayType:
+		if e.Len != nil {
+			return typeInfo{}, fmt.Errorf("fixed-size arrays are not supported")
+		}
+		elem, err := typeInfoFromExpr(e.Elt, layout)
+		if err != nil {
+			return typeInfo{}, err
+		}
+		return typeInfo{Kind: kindSlice, GoType: "[]" + elem.GoType, Elem: &elem}, nil
+	case *ast.SelectorExpr:
+		if x, ok := e.X.(*ast.Ident); ok && x.Name == "time" && e.Sel.Name == "Time" {
+			return typeInfo{Kind: kindTime, GoType: "time.Time", Layout: layout}, nil
+		}
+		return typeInfo{}, fmt.Errorf("unsupported type %s.%s", e.X, e.Sel.Name)
+	default:
+		return typeInfo{}, fmt.Errorf("unsupported field type")
+	}
+}
+
+func render(pkgName string, structs []structType, includeHelpers bool) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by jsonlexergen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", pkgName)
+	stdlib := []string{"io"}
+	if includeHelpers {
+		// strconv is only used by the jsonlexergenWrite* helpers below.
+		stdlib = append(stdlib, "strconv")
+	}
+	if needsTimeImport(structs) {
+		stdlib = append(stdlib, "time")
+	}
+	fmt.Fprintf(&b, "import (\n")
+	for _, pkg := range stdlib {
+		fmt.Fprintf(&b, "\t%q\n", pkg)
+	}
+	fmt.Fprintf(&b, "\n\t\"github.com/lukpank/jsonlexer\"\n)\n\n")
+
+	for _, s := range structs {
+		renderUnmarshal(&b, s)
+		renderMarshal(&b, s)
+	}
+	if includeHelpers {
+		renderHelpers(&b)
+	}
+	return b.Bytes()
+}
+
+// needsTimeImport reports whether any field in structs (recursively
+// through pointer and slice element types) requires the "time"
+// package, i.e. whether render must import it.
+func needsTimeImport(structs []structType) bool {
+	for _, s := range structs {
+		for _, f := range s.Fields {
+			if typeNeedsTime(f.Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func typeNeedsTime(t typeInfo) bool {
+	switch t.Kind {
+	case kindTime:
+		return true
+	case kindPointer, kindSlice:
+		return typeNeedsTime(*t.Elem)
+	default:
+		return false
+	}
+}
+
+func renderUnmarshal(b *bytes.Buffer, s structType) {
+	fmt.Fprintf(b, "func (v *%s) UnmarshalJSONLexer(l *jsonlexer.Lexer) error {\n", s.Name)
+	fmt.Fprintf(b, "\tif err := l.Delim('{'); err != nil {\n\t\treturn err\n\t}\n")
+	fmt.Fprintf(b, "\tfor {\n")
+	fmt.Fprintf(b, "\t\tmore, err := l.More()\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n")
+	fmt.Fprintf(b, "\t\tif !more {\n\t\t\tbreak\n\t\t}\n")
+	fmt.Fprintf(b, "\t\tkey, err := l.String()\n\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n")
+	fmt.Fprintf(b, "\t\tif err := l.Delim(':'); err != nil {\n\t\t\treturn err\n\t\t}\n")
+	fmt.Fprintf(b, "\t\tswitch key {\n")
+	for _, f := range s.Fields {
+		fmt.Fprintf(b, "\t\tcase %q:\n", f.JSONName)
+		fmt.Fprintf(b, "\t\t\t{\n%s\t\t\t}\n", indent(genDecode(fmt.Sprintf("v.%s", f.GoName), f.Type), 4))
+	}
+	fmt.Fprintf(b, "\t\tdefault:\n\t\t\tif err := l.Skip(); err != nil {\n\t\t\t\treturn err\n\t\t\t}\n")
+	fmt.Fprintf(b, "\t\t}\n\t}\n")
+	fmt.Fprintf(b, "\treturn l.Delim('}')\n}\n\n")
+}
+
+// genDecode returns the Go statements that read a single value of
+// type t from l into dst (a Go lvalue expression such as "v.Name" or
+// "e").
+func genDecode(dst string, t typeInfo) string {
+	switch t.Kind {
+	case kindString:
+		return fmt.Sprintf("s, err := l.String()\nif err != nil {\n\treturn err\n}\n%s = s\n", dst)
+	case kindBool:
+		return fmt.Sprintf("b, err := l.Bool()\nif err != nil {\n\treturn err\n}\n%s = b\n", dst)
+	case kindInt:
+		if t.GoType == "int64" {
+			return fmt.Sprintf("n, err := l.Int64()\nif err != nil {\n\treturn err\n}\n%s = n\n", dst)
+		}
+		return fmt.Sprintf("n, err := l.Int64()\nif err != nil {\n\treturn err\n}\n%s = %s(n)\n", dst, t.GoType)
+	case kindUint:
+		if t.GoType == "uint64" {
+			return fmt.Sprintf("n, err := l.Uint64()\nif err != nil {\n\treturn err\n}\n%s = n\n", dst)
+		}
+		return fmt.Sprintf("n, err := l.Uint64()\nif err != nil {\n\treturn err\n}\n%s = %s(n)\n", dst, t.GoType)
+	case kindFloat:
+		if t.Float32 {
+			return fmt.Sprintf("f, err := l.Float32()\nif err != nil {\n\treturn err\n}\n%s = f\n", dst)
+		}
+		return fmt.Sprintf("f, err := l.Float64()\nif err != nil {\n\treturn err\n}\n%s = f\n", dst)
+	case kindStruct:
+		return fmt.Sprintf("if err := (&%s).UnmarshalJSONLexer(l); err != nil {\n\treturn err\n}\n", dst)
+	case kindTime:
+		return fmt.Sprintf(
+			"s, err := l.String()\nif err != nil {\n\treturn err\n}\nt, err := time.Parse(%q, s)\nif err != nil {\n\treturn err\n}\n%s = t\n",
+			t.Layout, dst)
+	case kindPointer:
+		return fmt.Sprintf(
+			"typ, err := l.TokenType()\nif err != nil {\n\treturn err\n}\nif typ == jsonlexer.TypeNull {\n\tif err := l.Null(); err != nil {\n\t\treturn err\n\t}\n\t%s = nil\n} else {\n\tp := new(%s)\n%s\t%s = p\n}\n",
+			dst, strings.TrimPrefix(t.GoType, "*"), indent(genDecode("(*p)", *t.Elem), 1), dst)
+	case kindSlice:
+		return fmt.Sprintf(
+			"if err := l.Delim('['); err != nil {\n\treturn err\n}\n%s = nil\nfor {\n\tmore, err := l.More()\n\tif err != nil {\n\t\treturn err\n\t}\n\tif !more {\n\t\tbreak\n\t}\n\tvar e %s\n%s\t%s = append(%s, e)\n}\nif err := l.Delim(']'); err != nil {\n\treturn err\n}\n",
+			dst, t.Elem.GoType, indent(genDecode("e", *t.Elem), 1), dst, dst)
+	default:
+		panic("jsonlexergen: unsupported kind")
+	}
+}
+
+func renderMarshal(b *bytes.Buffer, s structType) {
+	fmt.Fprintf(b, "func (v *%s) MarshalJSONLexer(w io.Writer) error {\n", s.Name)
+	fmt.Fprintf(b, "\tif _, err := io.WriteString(w, \"{\"); err != nil {\n\t\treturn err\n\t}\n")
+	for i, f := range s.Fields {
+		if i > 0 {
+			fmt.Fprintf(b, "\tif _, err := io.WriteString(w, \",\"); err != nil {\n\t\treturn err\n\t}\n")
+		}
+		fmt.Fprintf(b, "\tif _, err := io.WriteString(w, %q); err != nil {\n\t\treturn err\n\t}\n", `"`+f.JSONName+`":`)
+		fmt.Fprintf(b, "%s", genEncode(fmt.Sprintf("v.%s", f.GoName), f.Type))
+	}
+	fmt.Fprintf(b, "\tif _, err := io.WriteString(w, \"}\"); err != nil {\n\t\treturn err\n\t}\n")
+	fmt.Fprintf(b, "\treturn nil\n}\n\n")
+}
+
+// genEncode returns the Go statements that write the JSON encoding of
+// src (a Go expression) to w.
+func genEncode(src string, t typeInfo) string {
+	switch t.Kind {
+	case kindString:
+		return fmt.Sprintf("if err := jsonlexergenWriteString(w, %s); err != nil {\n\treturn err\n}\n", src)
+	case kindBool:
+		return fmt.Sprintf("if err := jsonlexergenWriteBool(w, %s); err != nil {\n\treturn err\n}\n", src)
+	case kindInt:
+		return fmt.Sprintf("if err := jsonlexergenWriteInt(w, int64(%s)); err != nil {\n\treturn err\n}\n", src)
+	case kindUint:
+		return fmt.Sprintf("if err := jsonlexergenWriteUint(w, uint64(%s)); err != nil {\n\treturn err\n}\n", src)
+	case kindFloat:
+		bitSize := 64
+		if t.Float32 {
+			bitSize = 32
+		}
+		return fmt.Sprintf("if err := jsonlexergenWriteFloat(w, float64(%s), %d); err != nil {\n\treturn err\n}\n", src, bitSize)
+	case kindStruct:
+		return fmt.Sprintf("if err := (&%s).MarshalJSONLexer(w); err != nil {\n\treturn err\n}\n", src)
+	case kindTime:
+		return fmt.Sprintf("if err := jsonlexergenWriteString(w, %s.Format(%q)); err != nil {\n\treturn err\n}\n", src, t.Layout)
+	case kindPointer:
+		return fmt.Sprintf(
+			"if %s == nil {\n\tif _, err := io.WriteString(w, \"null\"); err != nil {\n\t\treturn err\n\t}\n} else {\n%s}\n",
+			src, indent(genEncode("(*"+src+")", *t.Elem), 1))
+	case kindSlice:
+		return fmt.Sprintf(
+			"if _, err := io.WriteString(w, \"[\"); err != nil {\n\treturn err\n}\nfor i, e := range %s {\n\tif i > 0 {\n\t\tif _, err := io.WriteString(w, \",\"); err != nil {\n\t\t\treturn err\n\t\t}\n\t}\n%s}\nif _, err := io.WriteString(w, \"]\"); err != nil {\n\treturn err\n}\n",
+			src, indent(genEncode("e", *t.Elem), 1))
+	default:
+		panic("jsonlexergen: unsupported kind")
+	}
+}
+
+// isHelperFuncName reports whether name is one of the package-level
+// functions renderHelpers emits, so Generate can recognize them in a
+// file already generated by a prior invocation and avoid redeclaring
+// them when generating into a second file in the same package.
+func isHelperFuncName(name string) bool {
+	switch name {
+	case "jsonlexergenWriteString", "jsonlexergenWriteBool", "jsonlexergenWriteInt", "jsonlexergenWriteUint", "jsonlexergenWriteFloat":
+		return true
+	default:
+		return false
+	}
+}
+
+func renderHelpers(b *bytes.Buffer) {
+	fmt.Fprint(b, `func jsonlexergenWriteString(w io.Writer, s string) error {
+	_, err := io.WriteString(w, strconv.Quote(s))
+	return err
+}
+
+func jsonlexergenWriteBool(w io.Writer, v bool) error {
+	_, err := io.WriteString(w, strconv.FormatBool(v))
+	return err
+}
+
+func jsonlexergenWriteInt(w io.Writer, n int64) error {
+	_, err := io.WriteString(w, strconv.FormatInt(n, 10))
+	return err
+}
+
+func jsonlexergenWriteUint(w io.Writer, n uint64) error {
+	_, err := io.WriteString(w, strconv.FormatUint(n, 10))
+	return err
+}
+
+func jsonlexergenWriteFloat(w io.Writer, f float64, bitSize int) error {
+	_, err := io.WriteString(w, strconv.FormatFloat(f, 'g', -1, bitSize))
+	return err
+}
+`)
+}
+
+// indent prefixes every non-empty line of s with depth tabs.
+func indent(s string, depth int) string {
+	prefix := strings.Repeat("\t", depth)
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,215 @@
+// Copyright 2017 Łukasz Pankowski <lukpank at o2 dot pl>. All rights
+// reserved.  This source code is licensed under the terms of the MIT
+// license. See LICENSE file for details.
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	src, err := Generate("testdata/fixture", []string{"Person"}, "testdata/fixture/fixture_jsonlexergen.go")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := string(src)
+
+	for _, want := range []string{
+		"package fixture",
+		"func (v *Person) UnmarshalJSONLexer(l *jsonlexer.Lexer) error {",
+		"func (v *Person) MarshalJSONLexer(w io.Writer) error {",
+		`case "name":`,
+		`case "address":`,
+		"(&v.Address).UnmarshalJSONLexer(l)",
+		"l.Delim('[')",                // Tags is a slice
+		"jsonlexer.TypeNull",          // Nickname is a pointer
+		`time.Parse("2006-01-02", s)`, // CreatedAt uses the layout tag
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("generated source does not contain %q\n%s", want, out)
+		}
+	}
+}
+
+// TestGenerateCompilesAndRoundTrips generates code for the fixture
+// package into a standalone module, compiles it against the real
+// jsonlexer package and checks that a value survives a
+// Marshal/Unmarshal round trip. This is what would have caught the
+// "time" import being emitted unconditionally: substring assertions
+// on the generated source do not exercise the compiler.
+func TestGenerateCompilesAndRoundTrips(t *testing.T) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain not available")
+	}
+	repoRoot, err := filepath.Abs("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := Generate("testdata/fixture", []string{"Person", "Address"}, "testdata/fixture/fixture_jsonlexergen.go")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fixtureSrc, err := os.ReadFile("testdata/fixture/types.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"types.go":                fixtureSrc,
+		"fixture_jsonlexergen.go": src,
+		"roundtrip_test.go":       []byte(roundTripTestSrc),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	goMod := "module jsonlexergentest\n\ngo 1.21\n\nrequire github.com/lukpank/jsonlexer v0.0.0\n\nreplace github.com/lukpank/jsonlexer => " + repoRoot + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(goBin, "test", "./...")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("generated package failed to compile/round-trip: %v\n%s", err, out)
+	}
+}
+
+const roundTripTestSrc = `package fixture
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/lukpank/jsonlexer"
+)
+
+func TestRoundTrip(t *testing.T) {
+	want := Person{
+		Name:      "Ada",
+		Age:       36,
+		Score:     9.5,
+		Active:    true,
+		Address:   Address{City: "London", Zip: "W1"},
+		Tags:      []string{"a", "b"},
+		CreatedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+
+	var buf bytes.Buffer
+	if err := want.MarshalJSONLexer(&buf); err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var got Person
+	l := jsonlexer.New(bytes.NewReader(buf.Bytes()))
+	if err := got.UnmarshalJSONLexer(l); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	if got.Name != want.Name || got.Age != want.Age || got.Active != want.Active ||
+		got.Address != want.Address || !got.CreatedAt.Equal(want.CreatedAt) ||
+		len(got.Tags) != len(want.Tags) {
+		t.Fatalf("round trip mismatch: got %+v, want %+v", got, want)
+	}
+}
+`
+
+func TestGenerateUnknownType(t *testing.T) {
+	if _, err := Generate("testdata/fixture", []string{"NoSuchType"}, "testdata/fixture/fixture_jsonlexergen.go"); err == nil {
+		t.Fatal("expected an error for an unknown type")
+	}
+}
+
+// TestGenerateTwoFilesShareHelpers reproduces generating into two
+// separate output files for the same package (as two //go:generate
+// directives for different types would): the jsonlexergenWrite*
+// helpers must be emitted into only the first file, or both fail to
+// compile with a "redeclared in this block" error.
+func TestGenerateTwoFilesShareHelpers(t *testing.T) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go toolchain not available")
+	}
+	repoRoot, err := filepath.Abs("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	fixtureSrc, err := os.ReadFile("testdata/fixture/types.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "types.go"), fixtureSrc, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	personOut := filepath.Join(dir, "person_jsonlexergen.go")
+	personSrc, err := Generate(dir, []string{"Person"}, personOut)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.WriteFile(personOut, personSrc, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	addressOut := filepath.Join(dir, "address_jsonlexergen.go")
+	addressSrc, err := Generate(dir, []string{"Address"}, addressOut)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.WriteFile(addressOut, addressSrc, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(personSrc), "func jsonlexergenWriteString") {
+		t.Error("expected the first generated file to declare the helpers")
+	}
+	if strings.Contains(string(addressSrc), "func jsonlexergenWriteString") {
+		t.Error("expected the second generated file to reuse the first file's helpers, not redeclare them")
+	}
+
+	goMod := "module jsonlexergentest\n\ngo 1.21\n\nrequire github.com/lukpank/jsonlexer v0.0.0\n\nreplace github.com/lukpank/jsonlexer => " + repoRoot + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(goBin, "build", "./...")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("generated package failed to compile: %v\n%s", err, out)
+	}
+}
+
+func TestGenerateEmbeddedFieldUnsupported(t *testing.T) {
+	dir := t.TempDir()
+	const src = `package embedded
+
+type Base struct {
+	Name string
+}
+
+type Derived struct {
+	Base
+}
+`
+	if err := os.WriteFile(dir+"/types.go", []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Generate(dir, []string{"Derived"}, filepath.Join(dir, "embedded_jsonlexergen.go")); err == nil {
+		t.Fatal("expected an error for an embedded field")
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 Łukasz Pankowski <lukpank at o2 dot pl>. All rights
+// reserved.  This source code is licensed under the terms of the MIT
+// license. See LICENSE file for details.
+
+// Command jsonlexergen generates UnmarshalJSONLexer and
+// MarshalJSONLexer methods for the given struct types, driven by
+// jsonlexer.Lexer. It is meant to be invoked through go:generate, e.g.
+//
+//	//go:generate jsonlexergen -type Foo,Bar
+//
+// run from the package directory containing the Foo and Bar struct
+// declarations. The generated methods read and write fields without
+// reflection or map[string]interface{} allocation: unknown fields are
+// skipped with Lexer.Skip.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	typeNames := flag.String("type", "", "comma-separated list of struct type names to generate code for (required)")
+	output := flag.String("output", "", "output file name (default: <srcdir base>_jsonlexergen.go)")
+	dir := flag.String("dir", ".", "directory containing the package")
+	flag.Parse()
+
+	if *typeNames == "" {
+		fmt.Fprintln(os.Stderr, "jsonlexergen: -type is required")
+		return 2
+	}
+	types := strings.Split(*typeNames, ",")
+
+	out := *output
+	if out == "" {
+		abs, err := filepath.Abs(*dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "jsonlexergen:", err)
+			return 1
+		}
+		out = strings.ToLower(filepath.Base(abs)) + "_jsonlexergen.go"
+	}
+
+	src, err := Generate(*dir, types, filepath.Join(*dir, out))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "jsonlexergen:", err)
+		return 1
+	}
+	if err := os.WriteFile(filepath.Join(*dir, out), src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "jsonlexergen:", err)
+		return 1
+	}
+	return 0
+}
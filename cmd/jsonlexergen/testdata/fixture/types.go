@@ -0,0 +1,21 @@
+// Package fixture is a minimal set of struct types used by
+// generate_test.go to exercise jsonlexergen's code generation.
+package fixture
+
+import "time"
+
+type Address struct {
+	City string `json:"city"`
+	Zip  string `json:"zip"`
+}
+
+type Person struct {
+	Name      string    `json:"name"`
+	Age       int       `json:"age"`
+	Score     float64   `json:"score"`
+	Active    bool      `json:"active"`
+	Address   Address   `json:"address"`
+	Tags      []string  `json:"tags"`
+	Nickname  *string   `json:"nickname"`
+	CreatedAt time.Time `json:"created_at" layout:"2006-01-02"`
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 Łukasz Pankowski <lukpank at o2 dot pl>. All rights
+// reserved.  This source code is licensed under the terms of the MIT
+// license. See LICENSE file for details.
+
+package jsonlexer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SyntaxError is returned by Lexer for any malformed input (as opposed
+// to an error from the underlying io.Reader). Offset is the zero-based
+// byte offset, within the stream read so far, of the offending byte.
+// Path is a breadcrumb of the currently open objects and arrays, e.g.
+// ".users[3].email", empty at the top level.
+type SyntaxError struct {
+	Offset int64
+	Path   string
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("jsonlexer: at offset %d: %s", e.Offset, e.Msg)
+	}
+	return fmt.Sprintf("jsonlexer: at offset %d (%s): %s", e.Offset, e.Path, e.Msg)
+}
+
+// frameKind distinguishes the two kinds of container a lexer can be
+// positioned inside of for the purpose of the SyntaxError breadcrumb.
+type frameKind int
+
+const (
+	frameObject frameKind = iota
+	frameArray
+)
+
+// frame is one entry of a frameStack, tracking enough state about a
+// currently open object or array for More to find its first element
+// (rather than a separating comma) and, separately, to render the
+// frame as a breadcrumb segment for a later SyntaxError.
+type frame struct {
+	kind  frameKind
+	start bool   // true until More's first call for this frame
+	key   string // current key, set by Key/KeyBytes; frameObject only
+	index int    // current index, -1 before the first element; frameArray only
+}
+
+// frameStack is the stack of currently open objects/arrays, shared by
+// Lexer and SliceLexer so both produce the same SyntaxError breadcrumb
+// format.
+type frameStack []frame
+
+// push records that an object or array has just been opened.
+func (s *frameStack) push(kind frameKind) {
+	*s = append(*s, frame{kind: kind, start: true, index: -1})
+}
+
+// pop records that the innermost open object or array has just been
+// closed.
+func (s *frameStack) pop() {
+	if n := len(*s); n > 0 {
+		*s = (*s)[:n-1]
+	}
+}
+
+// top returns the innermost open object or array, or nil if none is
+// open (e.g. at the very top level).
+func (s frameStack) top() *frame {
+	if n := len(s); n > 0 {
+		return &s[n-1]
+	}
+	return nil
+}
+
+// setKey records the key currently being processed by the innermost
+// open object, for the breadcrumb rendered by a later SyntaxError.
+func (s frameStack) setKey(key string) {
+	if n := len(s); n > 0 && s[n-1].kind == frameObject {
+		s[n-1].key = key
+	}
+}
+
+// advanceIndex records that the innermost open array has just started
+// its next element, for the breadcrumb rendered by a later SyntaxError.
+func (s frameStack) advanceIndex() {
+	if n := len(s); n > 0 && s[n-1].kind == frameArray {
+		s[n-1].index++
+	}
+}
+
+func (s frameStack) breadcrumb() string {
+	var b strings.Builder
+	for _, f := range s {
+		switch f.kind {
+		case frameObject:
+			if f.key != "" {
+				b.WriteByte('.')
+				b.WriteString(f.key)
+			}
+		case frameArray:
+			if f.index >= 0 {
+				fmt.Fprintf(&b, "[%d]", f.index)
+			}
+		}
+	}
+	return b.String()
+}
+
+// syntaxError builds a *SyntaxError positioned at the lexer's current
+// offset and breadcrumb.
+func (l *Lexer) syntaxError(format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{Offset: l.offset, Path: l.stack.breadcrumb(), Msg: fmt.Sprintf(format, args...)}
+}
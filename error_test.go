@@ -0,0 +1,137 @@
+// Copyright 2017 Łukasz Pankowski <lukpank at o2 dot pl>. All rights
+// reserved.  This source code is licensed under the terms of the MIT
+// license. See LICENSE file for details.
+
+package jsonlexer_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lukpank/jsonlexer"
+)
+
+func TestLexerKeyAndForEachField(t *testing.T) {
+	r := &readers{S: `{"a": 1, "b": [2, 3]}`}
+	for i := 0; i < 2*r.Len(); i++ {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			l := jsonlexer.New(r.Get(i))
+			var a int64
+			var b []int64
+			err := l.ForEachField(func(key []byte) error {
+				switch string(key) {
+				case "a":
+					v, err := l.Int64()
+					if err != nil {
+						return err
+					}
+					a = v
+				case "b":
+					if err := l.Delim('['); err != nil {
+						return err
+					}
+					for {
+						more, err := l.More()
+						if err != nil {
+							return err
+						}
+						if !more {
+							break
+						}
+						v, err := l.Int64()
+						if err != nil {
+							return err
+						}
+						b = append(b, v)
+					}
+					return l.Delim(']')
+				default:
+					return l.Skip()
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if a != 1 || len(b) != 2 || b[0] != 2 || b[1] != 3 {
+				t.Errorf("got a=%d b=%v", a, b)
+			}
+		})
+	}
+}
+
+func TestLexerKeyBytes(t *testing.T) {
+	l := jsonlexer.New(strings.NewReader(`"name": "value"`))
+	key, err := l.KeyBytes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(key) != "name" {
+		t.Errorf("got %q", key)
+	}
+	expectedString(t, l, "value")
+}
+
+func TestSyntaxErrorOffsetAndPath(t *testing.T) {
+	l := jsonlexer.New(strings.NewReader(`{"users": [{}, {}, {"email": 123}]}`))
+	err := l.ForEachField(func(key []byte) error {
+		if string(key) != "users" {
+			return l.Skip()
+		}
+		if err := l.Delim('['); err != nil {
+			return err
+		}
+		for {
+			more, err := l.More()
+			if err != nil {
+				return err
+			}
+			if !more {
+				break
+			}
+			if err := l.ForEachField(func(key []byte) error {
+				if string(key) != "email" {
+					return l.Skip()
+				}
+				_, err := l.String()
+				return err
+			}); err != nil {
+				return err
+			}
+		}
+		return l.Delim(']')
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	se, ok := err.(*jsonlexer.SyntaxError)
+	if !ok {
+		t.Fatalf("expected a *jsonlexer.SyntaxError, got %T: %v", err, err)
+	}
+	if se.Path != ".users[2].email" {
+		t.Errorf("got path %q", se.Path)
+	}
+	const wantOffset = int64(len(`{"users": [{}, {}, {"email": `))
+	if se.Offset != wantOffset {
+		t.Errorf("got offset %d, want %d", se.Offset, wantOffset)
+	}
+}
+
+func TestSyntaxErrorTopLevel(t *testing.T) {
+	l := jsonlexer.New(strings.NewReader(`nope`))
+	_, err := l.Int64()
+	se, ok := err.(*jsonlexer.SyntaxError)
+	if !ok {
+		t.Fatalf("expected a *jsonlexer.SyntaxError, got %T: %v", err, err)
+	}
+	if se.Path != "" {
+		t.Errorf("got path %q, want empty at the top level", se.Path)
+	}
+	if se.Offset != 0 {
+		t.Errorf("got offset %d, want 0", se.Offset)
+	}
+	if !strings.Contains(err.Error(), "jsonlexer: at offset 0:") {
+		t.Errorf("unexpected error message: %v", err)
+	}
+}
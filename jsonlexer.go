@@ -7,38 +7,57 @@ package jsonlexer
 import (
 	"bytes"
 	"encoding/hex"
-	"errors"
-	"fmt"
 	"io"
 	"strconv"
 	"unicode/utf8"
 )
 
 type Lexer struct {
-	r     io.Reader
-	b     []byte
-	start bool
-	buf   [4096]byte
-	err   error
-	sbuf  bytes.Buffer
+	r      io.Reader
+	b      []byte
+	buf    [4096]byte
+	err    error
+	sbuf   bytes.Buffer
+	offset int64
+	stack  frameStack
 }
 
 func New(r io.Reader) *Lexer {
 	return &Lexer{r: r}
 }
 
+// advance consumes n bytes from the front of l.b, keeping l.offset (the
+// byte offset of the next unconsumed byte, used by SyntaxError) in
+// sync.
+func (l *Lexer) advance(n int) {
+	l.b = l.b[n:]
+	l.offset += int64(n)
+}
+
+// Peek returns the next non-space byte without consuming it, so a caller
+// can decide how to decode (or skip) the upcoming value before reading
+// it.
+func (l *Lexer) Peek() (byte, error) {
+	return l.nonSpaceByte()
+}
+
 // Delim should be use for the following characters: "[]{}:"
 func (l *Lexer) Delim(expected byte) error {
 	b, err := l.nonSpaceByte()
 	if err != nil {
 		return err
 	}
-	l.b = l.b[1:]
 	if b != expected {
-		return fmt.Errorf("expected %q but found %q", expected, b)
+		return l.syntaxError("expected %q but found %q", expected, b)
 	}
-	if expected == '[' || expected == '{' {
-		l.start = true
+	l.advance(1)
+	switch expected {
+	case '[':
+		l.stack.push(frameArray)
+	case '{':
+		l.stack.push(frameObject)
+	case ']', '}':
+		l.stack.pop()
 	}
 	return nil
 }
@@ -53,14 +72,16 @@ func (l *Lexer) More() (bool, error) {
 	if b == ']' || b == '}' {
 		return false, nil
 	}
-	if l.start {
-		l.start = false
+	if f := l.stack.top(); f != nil && f.start {
+		f.start = false
+		l.stack.advanceIndex()
 		return true, nil
 	}
 	if b != ',' {
-		return false, fmt.Errorf("expected ',' but found %q", b)
+		return false, l.syntaxError("expected ',' but found %q", b)
 	}
-	l.b = l.b[1:]
+	l.advance(1)
+	l.stack.advanceIndex()
 	return true, nil
 }
 
@@ -72,98 +93,206 @@ func (l *Lexer) EOF() error {
 		}
 		return err
 	}
-	return fmt.Errorf("expected EOF but found %q", b)
+	return l.syntaxError("expected EOF but found %q", b)
 }
 
-func (l *Lexer) Int64() (int64, error) {
-	_, err := l.nonSpaceByte()
+// Key reads an object key, i.e. a JSON string followed by the ':'
+// delimiter, in one call. It also records the key so that a later
+// SyntaxError can report it as part of its breadcrumb.
+func (l *Lexer) Key() (string, error) {
+	key, err := l.String()
 	if err != nil {
-		return 0, err
+		return "", err
+	}
+	l.stack.setKey(key)
+	if err := l.Delim(':'); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// KeyBytes is like Key but returns the key as a []byte, e.g. for a
+// switch over string(key). The result is a copy of the string read by
+// Key, so it does not save the string allocation.
+func (l *Lexer) KeyBytes() ([]byte, error) {
+	key, err := l.Key()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(key), nil
+}
+
+// ForEachField wraps the Delim('{') / More / Key / Delim('}') boilerplate
+// common to every object decoder: it calls fn once per field with the
+// field's key, leaving the corresponding value for fn to read (or Skip).
+func (l *Lexer) ForEachField(fn func(key []byte) error) error {
+	if err := l.Delim('{'); err != nil {
+		return err
 	}
-	j := -1
 	for {
-		for i, c := range l.b {
-			if c == '-' && i == 0 {
-				continue
-			}
-			if c < '0' || c > '9' {
-				j = i
-				break
-			}
+		more, err := l.More()
+		if err != nil {
+			return err
 		}
-		if j != -1 {
+		if !more {
 			break
 		}
-		if l.err == io.EOF {
-			j = len(l.b)
-			break
+		key, err := l.KeyBytes()
+		if err != nil {
+			return err
 		}
-		if len(l.b) == len(l.buf) {
-			return 0, errors.New("int64 number to long")
+		if err := fn(key); err != nil {
+			return err
 		}
-		n := copy(l.buf[:], l.b)
-		var m int
-		if l.err != nil {
-			return 0, l.err
+	}
+	return l.Delim('}')
+}
+
+// maxNumberLen is the longest number literal (the digits themselves,
+// not counting surrounding quotes) Lexer's Int64, Uint64, Float64 and
+// Float32 (and their quoted Str variants) accept; SliceLexer does not
+// apply it. It is far larger than any
+// legitimate int64/float64 representation needs and exists only to
+// bound how much a malformed, never-terminated number literal can
+// make the lexer buffer.
+const maxNumberLen = 512
+
+func isIntChar(c byte) bool {
+	return c >= '0' && c <= '9' || c == '-'
+}
+
+func isFloatChar(c byte) bool {
+	return c >= '0' && c <= '9' || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E'
+}
+
+// scanNumber reads a run of bytes matching isNumChar, starting with
+// the next non-space byte. Unlike the 4096-byte l.buf window it does
+// not stop at a fixed buffer boundary: a number that straddles a
+// refill is simply accumulated one byte at a time via peekRawByte, so
+// its length is bounded only by maxNumberLen, not by the internal
+// buffer size.
+func (l *Lexer) scanNumber(isNumChar func(byte) bool) ([]byte, error) {
+	first, err := l.nonSpaceByte()
+	if err != nil {
+		return nil, err
+	}
+	if !isNumChar(first) {
+		return nil, l.syntaxError("expected a number, got %q", first)
+	}
+	var dst bytes.Buffer
+	for {
+		b, ok, err := l.peekRawByte()
+		if err != nil {
+			return nil, err
 		}
-		m, l.err = l.r.Read(l.buf[n:])
-		if m == 0 && l.err != nil {
-			if l.err == io.EOF {
-				l.b = l.buf[:n+m]
-				j = n + m
-				break
-			}
-			return 0, l.err
+		if !ok || !isNumChar(b) {
+			break
 		}
-		l.b = l.buf[:n+m]
+		if dst.Len() >= maxNumberLen {
+			return nil, l.syntaxError("number literal too long (over %d bytes)", maxNumberLen)
+		}
+		l.advance(1)
+		dst.WriteByte(b)
+	}
+	return dst.Bytes(), nil
+}
+
+func (l *Lexer) Int64() (int64, error) {
+	s, err := l.scanNumber(isIntChar)
+	if err != nil {
+		return 0, err
 	}
-	s := string(l.b[:j])
-	l.b = l.b[j:]
-	return strconv.ParseInt(s, 10, 64)
+	return strconv.ParseInt(string(s), 10, 64)
+}
+
+// Uint64 is like Int64 but for values that do not fit in an int64,
+// such as the unsigned 64-bit counters some APIs emit.
+func (l *Lexer) Uint64() (uint64, error) {
+	s, err := l.scanNumber(isIntChar)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(string(s), 10, 64)
 }
 
 func (l *Lexer) Float64() (float64, error) {
-	_, err := l.nonSpaceByte()
+	s, err := l.scanNumber(isFloatChar)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(s), 64)
+}
+
+// Float32 is like Float64 but parses the result into a float32.
+func (l *Lexer) Float32() (float32, error) {
+	s, err := l.scanNumber(isFloatChar)
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(string(s), 32)
+	return float32(f), err
+}
+
+// Int64Str, Uint64Str and Float64Str expect a JSON string containing
+// a number, e.g. "123" rather than 123 — the representation many APIs
+// (protobuf JSON mapping, financial APIs) use to carry 64-bit integers
+// through JavaScript clients without losing precision. They read the
+// bytes between the quotes with scanQuotedNumber, which does not use
+// String's fast path, and pass them to strconv without going through
+// String.
+func (l *Lexer) Int64Str() (int64, error) {
+	s, err := l.scanQuotedNumber()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(s), 10, 64)
+}
+
+func (l *Lexer) Uint64Str() (uint64, error) {
+	s, err := l.scanQuotedNumber()
 	if err != nil {
 		return 0, err
 	}
-	j := -1
+	return strconv.ParseUint(string(s), 10, 64)
+}
+
+func (l *Lexer) Float64Str() (float64, error) {
+	s, err := l.scanQuotedNumber()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(s), 64)
+}
+
+// scanQuotedNumber reads a `"...numeric..."` literal and returns the
+// bytes between the quotes verbatim: JSON string escapes are not
+// processed (quoted numbers are not expected to contain them).
+func (l *Lexer) scanQuotedNumber() ([]byte, error) {
+	b, err := l.nonSpaceByte()
+	if err != nil {
+		return nil, err
+	}
+	if b != '"' {
+		return nil, l.syntaxError(`expected '"' to start string, got %q`, b)
+	}
+	l.advance(1)
+	var dst bytes.Buffer
 	for {
-		for i, c := range l.b {
-			if (c < '0' || c > '9') && c != '-' && c != '+' && c != '.' && c != 'e' && c != 'E' {
-				j = i
-				break
-			}
-		}
-		if j != -1 {
-			break
+		b, ok, err := l.takeRawByte()
+		if err != nil {
+			return nil, err
 		}
-		if l.err == io.EOF {
-			j = len(l.b)
-			break
+		if !ok {
+			return nil, l.syntaxError(`expected '"' ending but EOF encountered`)
 		}
-		if len(l.b) == len(l.buf) {
-			return 0, errors.New("float64 number to long")
+		if b == '"' {
+			return dst.Bytes(), nil
 		}
-		n := copy(l.buf[:], l.b)
-		var m int
-		if l.err != nil {
-			return 0, l.err
+		if dst.Len() >= maxNumberLen {
+			return nil, l.syntaxError("number literal too long (over %d bytes)", maxNumberLen)
 		}
-		m, l.err = l.r.Read(l.buf[n:])
-		if m == 0 && l.err != nil {
-			if l.err == io.EOF {
-				l.b = l.buf[:n+m]
-				j = n + m
-				break
-			}
-			return 0, l.err
-		}
-		l.b = l.buf[:n+m]
+		dst.WriteByte(b)
 	}
-	s := string(l.b[:j])
-	l.b = l.b[j:]
-	return strconv.ParseFloat(s, 64)
 }
 
 func (l *Lexer) Bool() (bool, error) {
@@ -180,24 +309,24 @@ func (l *Lexer) Bool() (bool, error) {
 		s = "true"
 		v = true
 	} else {
-		return false, errors.New(`expected true or false`)
+		return false, l.syntaxError(`expected true or false, got %q`, b)
 	}
 	for {
 		for i, c := range l.b {
 			if i == len(s) {
-				l.b = l.b[i:]
+				l.advance(i)
 				return v, nil
 			}
 			if c != s[i] {
-				return false, errors.New(`expected true or false`)
+				return false, l.syntaxError(`expected true or false`)
 			}
 		}
 		if len(l.b) >= len(s) || l.err == io.EOF {
-			l.b = l.b[len(s):]
+			l.advance(len(s))
 			return v, nil
 		}
 		if len(l.b) == len(l.buf) {
-			return false, errors.New("bool value to long")
+			return false, l.syntaxError("bool value too long")
 		}
 		n := copy(l.buf[:], l.b)
 		m, err := l.r.Read(l.buf[n:])
@@ -211,13 +340,52 @@ func (l *Lexer) Bool() (bool, error) {
 	}
 }
 
+// Null expects and consumes a JSON "null" literal.
+func (l *Lexer) Null() error {
+	b, err := l.nonSpaceByte()
+	if err != nil {
+		return err
+	}
+	if b != 'n' {
+		return l.syntaxError(`expected null, got %q`, b)
+	}
+	s := "null"
+	for {
+		for i, c := range l.b {
+			if i == len(s) {
+				l.advance(i)
+				return nil
+			}
+			if c != s[i] {
+				return l.syntaxError(`expected null`)
+			}
+		}
+		if len(l.b) >= len(s) || l.err == io.EOF {
+			l.advance(len(s))
+			return nil
+		}
+		if len(l.b) == len(l.buf) {
+			return l.syntaxError("null value too long")
+		}
+		n := copy(l.buf[:], l.b)
+		m, err := l.r.Read(l.buf[n:])
+		if m == 0 && err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		l.b = l.buf[:n+m]
+	}
+}
+
 func (l *Lexer) String() (string, error) {
 	b, err := l.nonSpaceByte()
 	if err != nil {
 		return "", err
 	}
 	if b != '"' {
-		return "", errors.New(`expected '"' to start string`)
+		return "", l.syntaxError(`expected '"' to start string, got %q`, b)
 	}
 	j := len(l.b)
 	for i, c := range l.b[1:] {
@@ -228,13 +396,13 @@ func (l *Lexer) String() (string, error) {
 		if c == '"' {
 			j := i + 1
 			s := string(l.b[1:j])
-			l.b = l.b[j+1:]
+			l.advance(j + 1)
 			return s, nil
 		}
 	}
 	l.sbuf.Reset()
 	l.sbuf.Write(l.b[1:j])
-	l.b = l.b[j:]
+	l.advance(j)
 
 	escape := false
 	for {
@@ -245,7 +413,7 @@ func (l *Lexer) String() (string, error) {
 		if k != -1 {
 			s := l.sbuf.String()
 			l.sbuf.Reset()
-			l.b = l.b[k+1:]
+			l.advance(k + 1)
 			return s, nil
 		}
 
@@ -254,7 +422,7 @@ func (l *Lexer) String() (string, error) {
 		m, l.err = l.r.Read(l.buf[n:])
 		if m == 0 && l.err != nil {
 			if l.err == io.EOF {
-				return "", errors.New(`expected '"' ending but EOF encountered`)
+				return "", l.syntaxError(`expected '"' ending but EOF encountered`)
 			}
 			return "", l.err
 		}
@@ -268,7 +436,7 @@ func (l *Lexer) StringValue(expected string) error {
 		return err
 	}
 	if b != '"' {
-		return errors.New(`expected '"' to start string`)
+		return l.syntaxError(`expected '"' to start string, got %q`, b)
 	}
 	j := len(l.b)
 	for i, c := range l.b[1:] {
@@ -278,14 +446,14 @@ func (l *Lexer) StringValue(expected string) error {
 		}
 		if c == '"' {
 			j := i + 1
-			err := equal(l.b[1:j], expected)
-			l.b = l.b[j+1:]
+			err := l.equal(l.b[1:j], expected)
+			l.advance(j + 1)
 			return err
 		}
 	}
 	l.sbuf.Reset()
 	l.sbuf.Write(l.b[1:j])
-	l.b = l.b[j:]
+	l.advance(j)
 
 	escape := false
 	for {
@@ -294,9 +462,9 @@ func (l *Lexer) StringValue(expected string) error {
 			return err
 		}
 		if k != -1 {
-			err := equal(l.sbuf.Bytes(), expected)
+			err := l.equal(l.sbuf.Bytes(), expected)
 			l.sbuf.Reset()
-			l.b = l.b[k+1:]
+			l.advance(k + 1)
 			return err
 		}
 
@@ -305,7 +473,7 @@ func (l *Lexer) StringValue(expected string) error {
 		m, l.err = l.r.Read(l.buf[n:])
 		if m == 0 && l.err != nil {
 			if l.err == io.EOF {
-				return errors.New(`expected '"' ending but EOF encountered`)
+				return l.syntaxError(`expected '"' ending but EOF encountered`)
 			}
 			return l.err
 		}
@@ -313,14 +481,9 @@ func (l *Lexer) StringValue(expected string) error {
 	}
 }
 
-func equal(b []byte, s string) error {
-	if len(b) != len(s) {
-		return fmt.Errorf("expected string %q but got %q", s, b)
-	}
-	for i, c := range b {
-		if c != s[i] {
-			return fmt.Errorf("expected string %q but got %q", s, b)
-		}
+func (l *Lexer) equal(b []byte, s string) error {
+	if len(b) != len(s) || string(b) != s {
+		return l.syntaxError("expected string %q but got %q", s, b)
 	}
 	return nil
 }
@@ -333,7 +496,7 @@ func (l *Lexer) complexStr(escape *bool) (int, error) {
 		if *escape {
 			switch c {
 			default:
-				return 0, fmt.Errorf("unexpected escaped char %q", c)
+				return 0, l.syntaxError("unexpected escaped char %q", c)
 			case '"', '\\', '/':
 				l.sbuf.WriteByte(c)
 			case 'b':
@@ -348,7 +511,7 @@ func (l *Lexer) complexStr(escape *bool) (int, error) {
 				l.sbuf.WriteByte('\t')
 			case 'u':
 				if i+5 > len(l.b) {
-					l.b = l.b[i:]
+					l.advance(i)
 					return -1, nil
 				}
 				if _, err := hex.Decode(x[:], l.b[i+1:i+5]); err != nil {
@@ -372,7 +535,7 @@ func (l *Lexer) complexStr(escape *bool) (int, error) {
 		}
 		if c >= 0x80 {
 			if !utf8.FullRune(l.b[i:]) {
-				l.b = l.b[i:]
+				l.advance(i)
 				return -1, nil
 			}
 			r, n := utf8.DecodeRune(l.b[i:])
@@ -383,7 +546,7 @@ func (l *Lexer) complexStr(escape *bool) (int, error) {
 		l.sbuf.WriteByte(c)
 		i++
 	}
-	l.b = nil
+	l.advance(len(l.b))
 	return -1, nil
 }
 
@@ -394,8 +557,7 @@ func (l *Lexer) Skip() error {
 	}
 	switch b {
 	default:
-		// TODO: support null
-		return fmt.Errorf("unexpected byte %q", b)
+		return l.syntaxError("unexpected byte %q", b)
 	case '[':
 		return l.skipArray()
 	case '{':
@@ -409,6 +571,8 @@ func (l *Lexer) Skip() error {
 	case 't', 'f':
 		_, err := l.Bool()
 		return err
+	case 'n':
+		return l.Null()
 	}
 }
 
@@ -474,7 +638,7 @@ func (l *Lexer) nonSpaceByte() (byte, error) {
 			if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
 				return b, nil
 			}
-			l.b = l.b[1:]
+			l.advance(1)
 		}
 	}
 }
@@ -0,0 +1,492 @@
+// Copyright 2017 Łukasz Pankowski <lukpank at o2 dot pl>. All rights
+// reserved.  This source code is licensed under the terms of the MIT
+// license. See LICENSE file for details.
+
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lukpank/jsonlexer"
+)
+
+// RawMessage is the JSON of a value matched by Eval. A value matched
+// while streaming is the exact source bytes, as captured by
+// jsonlexer.Lexer.Raw. A value matched inside a subtree Eval had
+// already decoded (below a filter predicate, or nested in another
+// match of a recursive-descent path) is re-encoded with json.Marshal,
+// so its whitespace, key order and string escapes may differ from the
+// source. Numbers keep their original digits in both cases instead of
+// being rounded through float64.
+type RawMessage []byte
+
+// Emit is called by Eval once for every value matching one of the
+// compiled paths. pathID is the index of the matching Path in the
+// paths passed to Eval.
+type Emit func(pathID int, value RawMessage)
+
+// state tracks, for one path, how many of its segments have already
+// been satisfied by the location evaluated so far.
+type state struct {
+	pathID int
+	segs   []segment
+	pos    int
+}
+
+// Eval evaluates paths against the token stream produced by l, calling
+// emit for every matching value. It never builds a DOM of the whole
+// document: subtrees that cannot satisfy any path are discarded with
+// l.Skip, and only matching subtrees (or subtrees containing a filter
+// predicate, which must be inspected to be tested) are decoded.
+func Eval(l *jsonlexer.Lexer, emit Emit, paths ...*Path) error {
+	states := make([]state, len(paths))
+	for i, p := range paths {
+		states[i] = state{pathID: i, segs: p.segs, pos: 0}
+	}
+	return handleChild(l, states, emit)
+}
+
+func evalValue(l *jsonlexer.Lexer, states []state, emit Emit) error {
+	if len(states) == 0 {
+		return l.Skip()
+	}
+	b, err := l.Peek()
+	if err != nil {
+		return err
+	}
+	switch b {
+	case '{':
+		return evalObject(l, states, emit)
+	case '[':
+		return evalArray(l, states, emit)
+	default:
+		return l.Skip()
+	}
+}
+
+func evalObject(l *jsonlexer.Lexer, states []state, emit Emit) error {
+	if err := l.Delim('{'); err != nil {
+		return err
+	}
+	for {
+		more, err := l.More()
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+		key, err := l.String()
+		if err != nil {
+			return err
+		}
+		if err := l.Delim(':'); err != nil {
+			return err
+		}
+		child := advanceForKey(states, key)
+		if err := handleChild(l, child, emit); err != nil {
+			return err
+		}
+	}
+	return l.Delim('}')
+}
+
+func evalArray(l *jsonlexer.Lexer, states []state, emit Emit) error {
+	if err := l.Delim('['); err != nil {
+		return err
+	}
+	for idx := 0; ; idx++ {
+		more, err := l.More()
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+		if needsFilterDecode(states) {
+			raw, err := cloneRaw(l)
+			if err != nil {
+				return err
+			}
+			v, err := decodeValue(jsonlexer.New(bytes.NewReader(raw)))
+			if err != nil {
+				return err
+			}
+			child := advanceForIndexWithFilter(states, idx, v)
+			if err := emitOrWalk(child, RawMessage(raw), v, true, emit); err != nil {
+				return err
+			}
+			continue
+		}
+		child := advanceForIndex(states, idx)
+		if err := handleChild(l, child, emit); err != nil {
+			return err
+		}
+	}
+	return l.Delim(']')
+}
+
+// handleChild decides, for the states remaining after matching a
+// single key or index, whether the corresponding value can be safely
+// skipped, must be streamed into recursively, or must be decoded
+// because it (or something inside it) matched a path.
+func handleChild(l *jsonlexer.Lexer, states []state, emit Emit) error {
+	if len(states) == 0 {
+		return l.Skip()
+	}
+	complete := false
+	for _, s := range states {
+		if s.pos == len(s.segs) {
+			complete = true
+			break
+		}
+	}
+	if !complete {
+		return evalValue(l, states, emit)
+	}
+	raw, err := cloneRaw(l)
+	if err != nil {
+		return err
+	}
+	return emitOrWalk(states, RawMessage(raw), nil, false, emit)
+}
+
+// cloneRaw reads the next value via l.Raw and copies it: l.Raw may
+// return a slice of l's internal buffer, valid only until l's next
+// read, but a RawMessage handed to an Emit callback (or stored in a
+// decodeValue result) must stay valid for as long as the caller keeps
+// it.
+func cloneRaw(l *jsonlexer.Lexer) ([]byte, error) {
+	raw, err := l.Raw()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), raw...), nil
+}
+
+// emitOrWalk emits raw verbatim for every state that has matched in
+// full at this node. For any remaining states (recursive descent, or
+// a filter predicate still to resolve deeper in the tree) it decodes
+// raw generically — lazily, and at most once, since most calls have
+// no such states — and keeps matching against that. v/haveV let a
+// caller that already decoded raw (to resolve a filter) pass it in
+// instead of decoding it twice.
+func emitOrWalk(states []state, raw RawMessage, v interface{}, haveV bool, emit Emit) error {
+	for _, s := range states {
+		if s.pos == len(s.segs) {
+			emit(s.pathID, raw)
+			continue
+		}
+		if !haveV {
+			var err error
+			v, err = decodeValue(jsonlexer.New(bytes.NewReader(raw)))
+			if err != nil {
+				return err
+			}
+			haveV = true
+		}
+		walkGeneric(v, []state{s}, emit)
+	}
+	return nil
+}
+
+func marshal(v interface{}) RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		// v was produced by decodeValue, so it is always one of
+		// map[string]interface{}, []interface{}, string, json.Number,
+		// bool or nil, all of which json.Marshal always accepts.
+		panic(fmt.Sprintf("jsonpath: unexpected marshal error: %v", err))
+	}
+	return RawMessage(b)
+}
+
+// walkGeneric continues matching against an already decoded value; it
+// is used once a subtree has been decoded (because some path matched a
+// filter predicate or completed inside it) so that other, still
+// incomplete, paths can keep looking without going back to the lexer.
+func walkGeneric(v interface{}, states []state, emit Emit) {
+	if len(states) == 0 {
+		return
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, child := range val {
+			childStates := advanceForKey(states, key)
+			dispatchGeneric(child, childStates, emit)
+		}
+	case []interface{}:
+		for idx, child := range val {
+			childStates := advanceForIndexGeneric(states, idx, child)
+			dispatchGeneric(child, childStates, emit)
+		}
+	}
+}
+
+func dispatchGeneric(v interface{}, states []state, emit Emit) {
+	for _, s := range states {
+		if s.pos == len(s.segs) {
+			emit(s.pathID, marshal(v))
+		} else {
+			walkGeneric(v, []state{s}, emit)
+		}
+	}
+}
+
+// advanceForIndexGeneric is like advanceForIndex but also resolves
+// filter predicates, since the whole value is already in memory.
+func advanceForIndexGeneric(states []state, idx int, v interface{}) []state {
+	var out []state
+	for _, s := range states {
+		seg := s.segs[s.pos]
+		if seg.kind == kindRecursive {
+			out = append(out, s)
+			if s.pos+1 < len(s.segs) {
+				out = append(out, advanceOneGeneric(s, s.pos+1, idx, v)...)
+			}
+			continue
+		}
+		out = append(out, advanceOneGeneric(s, s.pos, idx, v)...)
+	}
+	return out
+}
+
+func advanceOneGeneric(s state, pos int, idx int, v interface{}) []state {
+	seg := s.segs[pos]
+	if seg.kind == kindFilter {
+		if matchFilter(seg, v) {
+			return []state{{s.pathID, s.segs, pos + 1}}
+		}
+		return nil
+	}
+	if matchIndex(seg, idx) {
+		return []state{{s.pathID, s.segs, pos + 1}}
+	}
+	return nil
+}
+
+// advanceForKey returns, for each input state, the states that should
+// be carried into the value stored under key, handling recursive
+// descent (which stays active at every depth).
+func advanceForKey(states []state, key string) []state {
+	var out []state
+	for _, s := range states {
+		seg := s.segs[s.pos]
+		if seg.kind == kindRecursive {
+			out = append(out, s)
+			if s.pos+1 < len(s.segs) && matchKey(s.segs[s.pos+1], key) {
+				out = append(out, state{s.pathID, s.segs, s.pos + 2})
+			}
+			continue
+		}
+		if matchKey(seg, key) {
+			out = append(out, state{s.pathID, s.segs, s.pos + 1})
+		}
+	}
+	return out
+}
+
+// advanceForIndex is like advanceForKey but for array elements that
+// have not been decoded yet, so filter predicates cannot be resolved
+// here: needsFilterDecode must be checked by the caller first.
+func advanceForIndex(states []state, idx int) []state {
+	var out []state
+	for _, s := range states {
+		seg := s.segs[s.pos]
+		if seg.kind == kindRecursive {
+			out = append(out, s)
+			if s.pos+1 < len(s.segs) && matchIndex(s.segs[s.pos+1], idx) {
+				out = append(out, state{s.pathID, s.segs, s.pos + 2})
+			}
+			continue
+		}
+		if matchIndex(seg, idx) {
+			out = append(out, state{s.pathID, s.segs, s.pos + 1})
+		}
+	}
+	return out
+}
+
+// advanceForIndexWithFilter is advanceForIndex plus filter resolution
+// against an already decoded element.
+func advanceForIndexWithFilter(states []state, idx int, v interface{}) []state {
+	var out []state
+	for _, s := range states {
+		seg := s.segs[s.pos]
+		if seg.kind == kindRecursive {
+			out = append(out, s)
+			if s.pos+1 < len(s.segs) {
+				out = append(out, advanceOneGeneric(s, s.pos+1, idx, v)...)
+			}
+			continue
+		}
+		out = append(out, advanceOneGeneric(s, s.pos, idx, v)...)
+	}
+	return out
+}
+
+func needsFilterDecode(states []state) bool {
+	for _, s := range states {
+		seg := s.segs[s.pos]
+		if seg.kind == kindFilter {
+			return true
+		}
+		if seg.kind == kindRecursive && s.pos+1 < len(s.segs) && s.segs[s.pos+1].kind == kindFilter {
+			return true
+		}
+	}
+	return false
+}
+
+func matchKey(seg segment, key string) bool {
+	switch seg.kind {
+	case kindKey:
+		return seg.key == key
+	case kindWildcard:
+		return true
+	default:
+		return false
+	}
+}
+
+func matchIndex(seg segment, idx int) bool {
+	switch seg.kind {
+	case kindIndex:
+		return seg.index == idx
+	case kindWildcard:
+		return true
+	case kindSlice:
+		if seg.hasStart && idx < seg.start {
+			return false
+		}
+		if seg.hasEnd && idx >= seg.end {
+			return false
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+func matchFilter(seg segment, v interface{}) bool {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	n, ok := m[seg.filterField].(json.Number)
+	if !ok {
+		return false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return false
+	}
+	switch seg.op {
+	case opLT:
+		return f < seg.filterValue
+	case opLE:
+		return f <= seg.filterValue
+	case opGT:
+		return f > seg.filterValue
+	case opGE:
+		return f >= seg.filterValue
+	case opEQ:
+		return f == seg.filterValue
+	case opNE:
+		return f != seg.filterValue
+	default:
+		return false
+	}
+}
+
+// decodeValue decodes the next JSON value from l into a generic Go
+// value (map[string]interface{}, []interface{}, string, json.Number,
+// bool or nil for an object, array, string, number, bool or null
+// respectively). Numbers are kept as json.Number, not float64, so
+// that a value further decoded this way for recursive descent or a
+// filter predicate does not lose precision if it is also emitted.
+// decodeValue is only used for values that matched a path, or that
+// must be inspected to test a filter predicate.
+func decodeValue(l *jsonlexer.Lexer) (interface{}, error) {
+	b, err := l.Peek()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case b == '{':
+		return decodeObject(l)
+	case b == '[':
+		return decodeArray(l)
+	case b == '"':
+		return l.String()
+	case b == 't' || b == 'f':
+		return l.Bool()
+	case b == 'n':
+		return nil, l.Null()
+	default:
+		raw, err := cloneRaw(l)
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(raw), nil
+	}
+}
+
+func decodeObject(l *jsonlexer.Lexer) (map[string]interface{}, error) {
+	if err := l.Delim('{'); err != nil {
+		return nil, err
+	}
+	m := map[string]interface{}{}
+	for {
+		more, err := l.More()
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+		key, err := l.String()
+		if err != nil {
+			return nil, err
+		}
+		if err := l.Delim(':'); err != nil {
+			return nil, err
+		}
+		v, err := decodeValue(l)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	if err := l.Delim('}'); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func decodeArray(l *jsonlexer.Lexer) ([]interface{}, error) {
+	if err := l.Delim('['); err != nil {
+		return nil, err
+	}
+	var a []interface{}
+	for {
+		more, err := l.More()
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+		v, err := decodeValue(l)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	if err := l.Delim(']'); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
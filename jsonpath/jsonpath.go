@@ -0,0 +1,328 @@
+// Copyright 2017 Łukasz Pankowski <lukpank at o2 dot pl>. All rights
+// reserved.  This source code is licensed under the terms of the MIT
+// license. See LICENSE file for details.
+
+// Package jsonpath evaluates JSONPath expressions directly against the
+// token stream produced by jsonlexer.Lexer, without ever decoding the
+// whole document into a DOM. Subtrees that cannot match any of the
+// compiled paths are discarded with Lexer.Skip; only the subtrees that
+// do match, and the array elements a filter predicate is tested
+// against, are decoded, so the cost of evaluating a path without a
+// filter is roughly proportional to the size of its matches, not to
+// the size of the document.
+package jsonpath
+
+import "fmt"
+
+type kind int
+
+const (
+	kindKey kind = iota
+	kindWildcard
+	kindRecursive
+	kindIndex
+	kindSlice
+	kindFilter
+)
+
+type filterOp int
+
+const (
+	opLT filterOp = iota
+	opLE
+	opGT
+	opGE
+	opEQ
+	opNE
+)
+
+type segment struct {
+	kind kind
+
+	key string // kindKey
+
+	index int // kindIndex
+
+	hasStart, hasEnd bool // kindSlice
+	start, end       int
+
+	filterField string   // kindFilter
+	op          filterOp // kindFilter
+	filterValue float64  // kindFilter
+}
+
+// Path is a compiled JSONPath expression, ready to be evaluated with
+// Eval.
+type Path struct {
+	expr string
+	segs []segment
+}
+
+// String returns the original expression the Path was compiled from.
+func (p *Path) String() string {
+	return p.expr
+}
+
+// Compile compiles a JSONPath expression such as
+// "$.store.book[*].author", "$..price" or "$.store.book[0:2]" into a
+// Path that can be evaluated against a jsonlexer.Lexer with Eval.
+//
+// Supported syntax: dotted field access (".field"), bracket field
+// access ("['field']" or `["field"]`), wildcards ("*"), recursive
+// descent (".."), integer indices ("[0]"), slices ("[0:5]", with
+// either bound optional) and simple filter predicates
+// ("[?(@.field<10)]") using one of the operators <, <=, >, >=, ==, !=
+// against a numeric literal.
+func Compile(expr string) (*Path, error) {
+	p := &parser{s: expr}
+	segs, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("jsonpath: %s: %v", expr, err)
+	}
+	return &Path{expr: expr, segs: segs}, nil
+}
+
+type parser struct {
+	s string
+	i int
+}
+
+func (p *parser) parse() ([]segment, error) {
+	if !p.consume('$') {
+		return nil, fmt.Errorf("expression must start with '$'")
+	}
+	var segs []segment
+	for p.i < len(p.s) {
+		switch p.s[p.i] {
+		case '.':
+			p.i++
+			if p.consume('.') {
+				segs = append(segs, segment{kind: kindRecursive})
+				if p.i < len(p.s) && p.s[p.i] == '[' {
+					continue
+				}
+				name, err := p.readName()
+				if err != nil {
+					return nil, err
+				}
+				if name == "*" {
+					segs = append(segs, segment{kind: kindWildcard})
+				} else {
+					segs = append(segs, segment{kind: kindKey, key: name})
+				}
+				continue
+			}
+			if p.i < len(p.s) && p.s[p.i] == '[' {
+				continue
+			}
+			name, err := p.readName()
+			if err != nil {
+				return nil, err
+			}
+			if name == "*" {
+				segs = append(segs, segment{kind: kindWildcard})
+			} else {
+				segs = append(segs, segment{kind: kindKey, key: name})
+			}
+		case '[':
+			seg, err := p.readBracket()
+			if err != nil {
+				return nil, err
+			}
+			segs = append(segs, seg)
+		default:
+			return nil, fmt.Errorf("unexpected character %q at offset %d", p.s[p.i], p.i)
+		}
+	}
+	return segs, nil
+}
+
+func (p *parser) consume(b byte) bool {
+	if p.i < len(p.s) && p.s[p.i] == b {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) readName() (string, error) {
+	if p.i < len(p.s) && p.s[p.i] == '*' {
+		p.i++
+		return "*", nil
+	}
+	j := p.i
+	for j < len(p.s) && isNameByte(p.s[j]) {
+		j++
+	}
+	if j == p.i {
+		return "", fmt.Errorf("expected field name at offset %d", p.i)
+	}
+	name := p.s[p.i:j]
+	p.i = j
+	return name, nil
+}
+
+func isNameByte(b byte) bool {
+	return b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+}
+
+func (p *parser) readBracket() (segment, error) {
+	p.i++ // '['
+	if p.i >= len(p.s) {
+		return segment{}, fmt.Errorf("unterminated '['")
+	}
+	j := indexByte(p.s, p.i, ']')
+	if j == -1 {
+		return segment{}, fmt.Errorf("unterminated '['")
+	}
+	inner := p.s[p.i:j]
+	p.i = j + 1
+
+	switch {
+	case inner == "*":
+		return segment{kind: kindWildcard}, nil
+	case len(inner) > 1 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+		return segment{kind: kindKey, key: inner[1 : len(inner)-1]}, nil
+	case len(inner) > 1 && inner[0] == '?':
+		return p.parseFilter(inner)
+	default:
+		return parseIndexOrSlice(inner)
+	}
+}
+
+func indexByte(s string, from int, b byte) int {
+	for i := from; i < len(s); i++ {
+		if s[i] == b {
+			return i
+		}
+	}
+	return -1
+}
+
+func parseIndexOrSlice(s string) (segment, error) {
+	colon := indexByte(s, 0, ':')
+	if colon == -1 {
+		n, err := parseInt(s)
+		if err != nil {
+			return segment{}, fmt.Errorf("bad index %q: %v", s, err)
+		}
+		return segment{kind: kindIndex, index: n}, nil
+	}
+	seg := segment{kind: kindSlice}
+	if before := s[:colon]; before != "" {
+		n, err := parseInt(before)
+		if err != nil {
+			return segment{}, fmt.Errorf("bad slice start %q: %v", before, err)
+		}
+		seg.hasStart, seg.start = true, n
+	}
+	if after := s[colon+1:]; after != "" {
+		n, err := parseInt(after)
+		if err != nil {
+			return segment{}, fmt.Errorf("bad slice end %q: %v", after, err)
+		}
+		seg.hasEnd, seg.end = true, n
+	}
+	return seg, nil
+}
+
+func parseInt(s string) (int, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty integer")
+	}
+	neg := false
+	i := 0
+	if s[0] == '-' {
+		neg = true
+		i = 1
+	}
+	if i == len(s) {
+		return 0, fmt.Errorf("not an integer")
+	}
+	n := 0
+	for ; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, fmt.Errorf("not an integer")
+		}
+		n = n*10 + int(s[i]-'0')
+	}
+	if neg {
+		n = -n
+	}
+	return n, nil
+}
+
+// parseFilter parses the content of "[?(@.field<10)]" (the leading '?'
+// is still present in s).
+func (p *parser) parseFilter(s string) (segment, error) {
+	s = s[1:] // '?'
+	s = trimMatching(s, '(', ')')
+	if len(s) < 2 || s[0] != '@' || s[1] != '.' {
+		return segment{}, fmt.Errorf("filter %q must start with '@.'", s)
+	}
+	s = s[2:]
+	ops := []struct {
+		s  string
+		op filterOp
+	}{
+		{"<=", opLE}, {">=", opGE}, {"==", opEQ}, {"!=", opNE}, {"<", opLT}, {">", opGT},
+	}
+	for _, o := range ops {
+		if i := indexOf(s, o.s); i != -1 {
+			field := s[:i]
+			value, err := parseFloat(s[i+len(o.s):])
+			if err != nil {
+				return segment{}, fmt.Errorf("filter value: %v", err)
+			}
+			return segment{kind: kindFilter, filterField: field, op: o.op, filterValue: value}, nil
+		}
+	}
+	return segment{}, fmt.Errorf("filter %q has no comparison operator", s)
+}
+
+func trimMatching(s string, open, close byte) string {
+	if len(s) >= 2 && s[0] == open && s[len(s)-1] == close {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func indexOf(s, sub string) int {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		if s[i:i+len(sub)] == sub {
+			return i
+		}
+	}
+	return -1
+}
+
+func parseFloat(s string) (float64, error) {
+	var f float64
+	var neg bool
+	i := 0
+	if i < len(s) && s[i] == '-' {
+		neg = true
+		i++
+	}
+	start := i
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		f = f*10 + float64(s[i]-'0')
+		i++
+	}
+	if i < len(s) && s[i] == '.' {
+		i++
+		frac := 0.1
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			f += float64(s[i]-'0') * frac
+			frac /= 10
+			i++
+		}
+	}
+	if i == start || i != len(s) {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	if neg {
+		f = -f
+	}
+	return f, nil
+}
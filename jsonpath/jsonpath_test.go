@@ -0,0 +1,128 @@
+// Copyright 2017 Łukasz Pankowski <lukpank at o2 dot pl>. All rights
+// reserved.  This source code is licensed under the terms of the MIT
+// license. See LICENSE file for details.
+
+package jsonpath_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lukpank/jsonlexer"
+	"github.com/lukpank/jsonlexer/jsonpath"
+)
+
+const doc = `{
+	"store": {
+		"book": [
+			{"category": "fiction", "author": "A", "price": 8.95},
+			{"category": "fiction", "author": "B", "price": 12.99},
+			{"category": "reference", "author": "C", "price": 8.99}
+		],
+		"bicycle": {"color": "red", "price": 19.95}
+	}
+}`
+
+func eval(t *testing.T, expr string) []string {
+	t.Helper()
+	p, err := jsonpath.Compile(expr)
+	if err != nil {
+		t.Fatalf("Compile(%q): %v", expr, err)
+	}
+	var got []string
+	l := jsonlexer.New(strings.NewReader(doc))
+	err = jsonpath.Eval(l, func(pathID int, v jsonpath.RawMessage) {
+		got = append(got, string(v))
+	}, p)
+	if err != nil {
+		t.Fatalf("Eval(%q): %v", expr, err)
+	}
+	return got
+}
+
+func TestEvalWildcard(t *testing.T) {
+	got := eval(t, "$.store.book[*].author")
+	want := []string{`"A"`, `"B"`, `"C"`}
+	assertEqual(t, got, want)
+}
+
+func TestEvalRecursiveDescent(t *testing.T) {
+	got := eval(t, "$..price")
+	want := []string{"8.95", "12.99", "8.99", "19.95"}
+	assertEqual(t, got, want)
+}
+
+func TestEvalSlice(t *testing.T) {
+	got := eval(t, "$.store.book[0:2].author")
+	want := []string{`"A"`, `"B"`}
+	assertEqual(t, got, want)
+}
+
+func TestEvalIndex(t *testing.T) {
+	got := eval(t, "$.store.book[1].author")
+	want := []string{`"B"`}
+	assertEqual(t, got, want)
+}
+
+func TestEvalFilter(t *testing.T) {
+	got := eval(t, "$.store.book[?(@.price<10)].author")
+	want := []string{`"A"`, `"C"`}
+	assertEqual(t, got, want)
+}
+
+func TestEvalLargeIntegerPrecision(t *testing.T) {
+	l := jsonlexer.New(strings.NewReader(`{"id": 9007199254740993}`))
+	p, err := jsonpath.Compile("$.id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	err = jsonpath.Eval(l, func(pathID int, v jsonpath.RawMessage) {
+		got = append(got, string(v))
+	}, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, got, []string{"9007199254740993"})
+}
+
+func TestEvalMultiplePaths(t *testing.T) {
+	authors, err := jsonpath.Compile("$.store.book[*].author")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bicycleColor, err := jsonpath.Compile("$.store.bicycle.color")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [2][]string
+	l := jsonlexer.New(strings.NewReader(doc))
+	err = jsonpath.Eval(l, func(pathID int, v jsonpath.RawMessage) {
+		got[pathID] = append(got[pathID], string(v))
+	}, authors, bicycleColor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, got[0], []string{`"A"`, `"B"`, `"C"`})
+	assertEqual(t, got[1], []string{`"red"`})
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, expr := range []string{"", "store.book", "$.book[", "$.book[?(@.price)]"} {
+		if _, err := jsonpath.Compile(expr); err == nil {
+			t.Errorf("Compile(%q): expected error", expr)
+		}
+	}
+}
+
+func assertEqual(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
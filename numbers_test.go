@@ -0,0 +1,170 @@
+// Copyright 2017 Łukasz Pankowski <lukpank at o2 dot pl>. All rights
+// reserved.  This source code is licensed under the terms of the MIT
+// license. See LICENSE file for details.
+
+package jsonlexer_test
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lukpank/jsonlexer"
+)
+
+func TestLexerUint64(t *testing.T) {
+	r := &readers{S: "18446744073709551615"}
+	for i := 0; i < 2*r.Len(); i++ {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			l := jsonlexer.New(r.Get(i))
+			got, err := l.Uint64()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != 18446744073709551615 {
+				t.Errorf("got %d", got)
+			}
+		})
+	}
+}
+
+func TestLexerFloat32(t *testing.T) {
+	l := jsonlexer.New(strings.NewReader("1.5"))
+	got, err := l.Float32()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 1.5 {
+		t.Errorf("got %g", got)
+	}
+}
+
+func TestLexerQuotedNumbers(t *testing.T) {
+	l := jsonlexer.New(strings.NewReader(`"9223372036854775807"`))
+	i, err := l.Int64Str()
+	if err != nil || i != 9223372036854775807 {
+		t.Fatalf("got %d, %v", i, err)
+	}
+
+	l = jsonlexer.New(strings.NewReader(`"18446744073709551615"`))
+	u, err := l.Uint64Str()
+	if err != nil || u != 18446744073709551615 {
+		t.Fatalf("got %d, %v", u, err)
+	}
+
+	l = jsonlexer.New(strings.NewReader(`"1.5"`))
+	f, err := l.Float64Str()
+	if err != nil || f != 1.5 {
+		t.Fatalf("got %g, %v", f, err)
+	}
+
+	l = jsonlexer.New(strings.NewReader(`"not a number`))
+	if _, err := l.Int64Str(); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// TestLexerNumberTooLong exercises maxNumberLen: a number literal far
+// longer than any legitimate int64/float64 needs is rejected with a
+// clear "too long" error rather than being accumulated without bound.
+func TestLexerNumberTooLong(t *testing.T) {
+	const n = 4096 + 100
+	var sb strings.Builder
+	sb.WriteByte('[')
+	for i := 0; i < n; i++ {
+		sb.WriteByte('9')
+	}
+	sb.WriteString(",1]")
+	s := sb.String()
+
+	l := jsonlexer.New(&splitNStringReader{s: s, split: 4096})
+	if err := l.Delim('['); err != nil {
+		t.Fatal(err)
+	}
+	expectedMore(t, l)
+	if _, err := l.Int64(); err == nil {
+		t.Fatal("expected a clear \"too long\" error for a genuinely oversized literal")
+	} else if !strings.Contains(err.Error(), "too long") {
+		t.Fatalf("expected a clear too-long error, got: %v", err)
+	}
+}
+
+// TestLexerNumberAcrossBufferBoundary exercises the case described in
+// the Int64/Float64 refill fix: a small, valid number whose digits are
+// positioned so that the lexer's internal 4096-byte buffer runs out
+// and is refilled from the reader in the middle of the literal. The
+// leading padding element pushes the second array element's digits to
+// straddle offset 4096, well under maxNumberLen, so this exercises the
+// refill path itself rather than the length cap.
+func TestLexerNumberAcrossBufferBoundary(t *testing.T) {
+	const padLen = 4086
+	digits := strings.Repeat("1", 18)
+	s := `["` + strings.Repeat("x", padLen) + `",` + digits + `,2]`
+
+	l := jsonlexer.New(&splitNStringReader{s: s, split: 4096})
+	if err := l.Delim('['); err != nil {
+		t.Fatal(err)
+	}
+	expectedMore(t, l)
+	if err := l.Skip(); err != nil {
+		t.Fatalf("unexpected error skipping padding: %v", err)
+	}
+	expectedMore(t, l)
+	got, err := l.Int64()
+	if err != nil {
+		t.Fatalf("unexpected error reading number straddling the buffer boundary: %v", err)
+	}
+	want, _ := strconv.ParseInt(digits, 10, 64)
+	if got != want {
+		t.Errorf("got %d, want %d", got, want)
+	}
+	expectedMore(t, l)
+	expectedInt64(t, l, 2)
+	if err := l.Delim(']'); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLexerNumberUnderMaxLen(t *testing.T) {
+	digits := strings.Repeat("1", 18)
+	s := "[" + digits + ",2]"
+	l := jsonlexer.New(&splitNStringReader{s: s, split: 4096})
+	if err := l.Delim('['); err != nil {
+		t.Fatal(err)
+	}
+	expectedMore(t, l)
+	got, err := l.Int64()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want, _ := strconv.ParseInt(digits, 10, 64)
+	if got != want {
+		t.Errorf("got %d, want %d", got, want)
+	}
+	expectedMore(t, l)
+	expectedInt64(t, l, 2)
+	if err := l.Delim(']'); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSliceLexerUint64Float32QuotedNumbers(t *testing.T) {
+	l := jsonlexer.NewSlice([]byte("18446744073709551615"))
+	u, err := l.Uint64()
+	if err != nil || u != 18446744073709551615 {
+		t.Fatalf("got %d, %v", u, err)
+	}
+
+	l = jsonlexer.NewSlice([]byte("1.5"))
+	f, err := l.Float32()
+	if err != nil || f != 1.5 {
+		t.Fatalf("got %g, %v", f, err)
+	}
+
+	l = jsonlexer.NewSlice([]byte(`"123"`))
+	i, err := l.Int64Str()
+	if err != nil || i != 123 {
+		t.Fatalf("got %d, %v", i, err)
+	}
+}
@@ -0,0 +1,569 @@
+// Copyright 2017 Łukasz Pankowski <lukpank at o2 dot pl>. All rights
+// reserved.  This source code is licensed under the terms of the MIT
+// license. See LICENSE file for details.
+
+package jsonlexer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// TokenReader is implemented by both Lexer, which reads from an
+// io.Reader, and SliceLexer, which reads directly from an in-memory
+// []byte. Code that does not care which one it is given should be
+// written against this interface. It does not include Null, TokenType,
+// Raw, Uint64, Float32 or the Key helpers.
+type TokenReader interface {
+	Delim(expected byte) error
+	More() (bool, error)
+	EOF() error
+	Int64() (int64, error)
+	Float64() (float64, error)
+	Bool() (bool, error)
+	String() (string, error)
+	StringValue(expected string) error
+	Skip() error
+}
+
+var (
+	_ TokenReader = (*Lexer)(nil)
+	_ TokenReader = (*SliceLexer)(nil)
+)
+
+// SliceLexer is a TokenReader that reads directly from a []byte
+// instead of an io.Reader, so it never copies input into an internal
+// buffer the way Lexer does. For the common case of decoding an
+// already fully-read-into-memory payload this roughly halves
+// allocations.
+//
+// When Unsafe is true and a string value contains no escapes and no
+// bytes outside of ASCII, String returns a string that aliases the
+// input []byte rather than copying it, so the returned string must not
+// be retained past the next mutation of the input or the next call
+// that advances the lexer; use StringCopy (or set Unsafe to false) for
+// a value that is safe to keep.
+type SliceLexer struct {
+	b      []byte
+	offset int64
+	stack  frameStack
+	Unsafe bool
+	sbuf   bytes.Buffer
+}
+
+// NewSlice returns a SliceLexer reading from b.
+func NewSlice(b []byte) *SliceLexer {
+	return &SliceLexer{b: b}
+}
+
+// advance consumes n bytes from the front of l.b, keeping l.offset (the
+// byte offset of the next unconsumed byte, used by SyntaxError) in
+// sync.
+func (l *SliceLexer) advance(n int) {
+	l.b = l.b[n:]
+	l.offset += int64(n)
+}
+
+// syntaxError builds a *SyntaxError positioned at the lexer's current
+// offset and breadcrumb.
+func (l *SliceLexer) syntaxError(format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{Offset: l.offset, Path: l.stack.breadcrumb(), Msg: fmt.Sprintf(format, args...)}
+}
+
+func (l *SliceLexer) Delim(expected byte) error {
+	b, err := l.nonSpaceByte()
+	if err != nil {
+		return err
+	}
+	if b != expected {
+		return l.syntaxError("expected %q but found %q", expected, b)
+	}
+	l.advance(1)
+	switch expected {
+	case '[':
+		l.stack.push(frameArray)
+	case '{':
+		l.stack.push(frameObject)
+	case ']', '}':
+		l.stack.pop()
+	}
+	return nil
+}
+
+func (l *SliceLexer) More() (bool, error) {
+	b, err := l.nonSpaceByte()
+	if err != nil {
+		return false, err
+	}
+	if b == ']' || b == '}' {
+		return false, nil
+	}
+	if f := l.stack.top(); f != nil && f.start {
+		f.start = false
+		l.stack.advanceIndex()
+		return true, nil
+	}
+	if b != ',' {
+		return false, l.syntaxError("expected ',' but found %q", b)
+	}
+	l.advance(1)
+	l.stack.advanceIndex()
+	return true, nil
+}
+
+// Key reads an object key, i.e. a JSON string followed by the ':'
+// delimiter, in one call. It also records the key so that a later
+// SyntaxError can report it as part of its breadcrumb.
+func (l *SliceLexer) Key() (string, error) {
+	key, err := l.String()
+	if err != nil {
+		return "", err
+	}
+	l.stack.setKey(key)
+	if err := l.Delim(':'); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// KeyBytes is like Key but returns the key as a []byte. The result is
+// a copy of the string read by Key, so it does not save an allocation.
+func (l *SliceLexer) KeyBytes() ([]byte, error) {
+	key, err := l.Key()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(key), nil
+}
+
+// ForEachField wraps the Delim('{') / More / Key / Delim('}') boilerplate
+// common to every object decoder: it calls fn once per field with the
+// field's key, leaving the corresponding value for fn to read (or Skip).
+func (l *SliceLexer) ForEachField(fn func(key []byte) error) error {
+	if err := l.Delim('{'); err != nil {
+		return err
+	}
+	for {
+		more, err := l.More()
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+		key, err := l.KeyBytes()
+		if err != nil {
+			return err
+		}
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	return l.Delim('}')
+}
+
+func (l *SliceLexer) EOF() error {
+	b, err := l.nonSpaceByte()
+	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	return l.syntaxError("expected EOF but found %q", b)
+}
+
+func (l *SliceLexer) scanNumber(isNumChar func(byte) bool) ([]byte, error) {
+	first, err := l.nonSpaceByte()
+	if err != nil {
+		return nil, err
+	}
+	if !isNumChar(first) {
+		return nil, l.syntaxError("expected a number, got %q", first)
+	}
+	j := len(l.b)
+	for i, c := range l.b {
+		if !isNumChar(c) {
+			j = i
+			break
+		}
+	}
+	s := l.b[:j]
+	l.advance(j)
+	return s, nil
+}
+
+func (l *SliceLexer) Int64() (int64, error) {
+	s, err := l.scanNumber(isIntChar)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(bytesToString(s), 10, 64)
+}
+
+// Uint64 is like Int64 but for values that do not fit in an int64.
+func (l *SliceLexer) Uint64() (uint64, error) {
+	s, err := l.scanNumber(isIntChar)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(bytesToString(s), 10, 64)
+}
+
+func (l *SliceLexer) Float64() (float64, error) {
+	s, err := l.scanNumber(isFloatChar)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(bytesToString(s), 64)
+}
+
+// Float32 is like Float64 but parses the result into a float32.
+func (l *SliceLexer) Float32() (float32, error) {
+	s, err := l.scanNumber(isFloatChar)
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(bytesToString(s), 32)
+	return float32(f), err
+}
+
+// Int64Str, Uint64Str and Float64Str expect a JSON string containing a
+// number, e.g. "123" rather than 123.
+func (l *SliceLexer) Int64Str() (int64, error) {
+	s, err := l.scanQuotedNumber()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(bytesToString(s), 10, 64)
+}
+
+func (l *SliceLexer) Uint64Str() (uint64, error) {
+	s, err := l.scanQuotedNumber()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(bytesToString(s), 10, 64)
+}
+
+func (l *SliceLexer) Float64Str() (float64, error) {
+	s, err := l.scanQuotedNumber()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(bytesToString(s), 64)
+}
+
+// scanQuotedNumber reads a `"...numeric..."` literal and returns the
+// bytes between the quotes.
+func (l *SliceLexer) scanQuotedNumber() ([]byte, error) {
+	b, err := l.nonSpaceByte()
+	if err != nil {
+		return nil, err
+	}
+	if b != '"' {
+		return nil, l.syntaxError(`expected '"' to start string, got %q`, b)
+	}
+	j := indexByteFrom(l.b, 1, '"')
+	if j == -1 {
+		return nil, l.syntaxError(`expected '"' ending but EOF encountered`)
+	}
+	s := l.b[1:j]
+	l.advance(j + 1)
+	return s, nil
+}
+
+func indexByteFrom(b []byte, from int, c byte) int {
+	for i := from; i < len(b); i++ {
+		if b[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+func (l *SliceLexer) Bool() (bool, error) {
+	b, err := l.nonSpaceByte()
+	if err != nil {
+		return false, err
+	}
+	var s string
+	var v bool
+	if b == 'f' {
+		s = "false"
+		v = false
+	} else if b == 't' {
+		s = "true"
+		v = true
+	} else {
+		return false, l.syntaxError(`expected true or false, got %q`, b)
+	}
+	if len(l.b) < len(s) || bytesToString(l.b[:len(s)]) != s {
+		return false, l.syntaxError(`expected true or false`)
+	}
+	l.advance(len(s))
+	return v, nil
+}
+
+// Null expects and consumes a JSON "null" literal.
+func (l *SliceLexer) Null() error {
+	b, err := l.nonSpaceByte()
+	if err != nil {
+		return err
+	}
+	if b != 'n' {
+		return l.syntaxError(`expected null, got %q`, b)
+	}
+	const s = "null"
+	if len(l.b) < len(s) || bytesToString(l.b[:len(s)]) != s {
+		return l.syntaxError(`expected null`)
+	}
+	l.advance(len(s))
+	return nil
+}
+
+// TokenType peeks the next non-space byte and reports the type of the
+// value it starts, without consuming any input.
+func (l *SliceLexer) TokenType() (Type, error) {
+	b, err := l.nonSpaceByte()
+	if err != nil {
+		return 0, err
+	}
+	switch b {
+	case 'n':
+		return TypeNull, nil
+	case 't', 'f':
+		return TypeBool, nil
+	case '"':
+		return TypeString, nil
+	case '[':
+		return TypeArrayStart, nil
+	case '{':
+		return TypeObjectStart, nil
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return TypeNumber, nil
+	default:
+		return 0, l.syntaxError("unexpected byte %q", b)
+	}
+}
+
+// Raw reads and returns the exact source bytes of the next JSON value.
+// Since SliceLexer already holds the whole input in memory, this is a
+// simple reslice with no copying.
+func (l *SliceLexer) Raw() ([]byte, error) {
+	if _, err := l.nonSpaceByte(); err != nil {
+		return nil, err
+	}
+	start := l.b
+	if err := l.Skip(); err != nil {
+		return nil, err
+	}
+	return start[:len(start)-len(l.b)], nil
+}
+
+func (l *SliceLexer) String() (string, error) {
+	b, err := l.nonSpaceByte()
+	if err != nil {
+		return "", err
+	}
+	if b != '"' {
+		return "", l.syntaxError(`expected '"' to start string, got %q`, b)
+	}
+	j := len(l.b)
+	for i, c := range l.b[1:] {
+		if c == '\\' || c >= 0x80 {
+			j = -1
+			break
+		}
+		if c == '"' {
+			j = i + 1
+			break
+		}
+	}
+	if j >= 0 {
+		s := l.b[1:j]
+		l.advance(j + 1)
+		if l.Unsafe {
+			return bytesToString(s), nil
+		}
+		return string(s), nil
+	}
+	return l.complexString()
+}
+
+// StringCopy is like String but always returns a freshly allocated
+// string, safe to retain regardless of the Unsafe setting.
+func (l *SliceLexer) StringCopy() (string, error) {
+	unsafe := l.Unsafe
+	l.Unsafe = false
+	s, err := l.String()
+	l.Unsafe = unsafe
+	return s, err
+}
+
+func (l *SliceLexer) complexString() (string, error) {
+	l.sbuf.Reset()
+	i := 1
+	escape := false
+	var x [2]byte
+	for i < len(l.b) {
+		c := l.b[i]
+		if escape {
+			switch c {
+			default:
+				return "", l.syntaxError("unexpected escaped char %q", c)
+			case '"', '\\', '/':
+				l.sbuf.WriteByte(c)
+			case 'b':
+				l.sbuf.WriteByte('\b')
+			case 'f':
+				l.sbuf.WriteByte('\f')
+			case 'n':
+				l.sbuf.WriteByte('\n')
+			case 'r':
+				l.sbuf.WriteByte('\r')
+			case 't':
+				l.sbuf.WriteByte('\t')
+			case 'u':
+				if i+5 > len(l.b) {
+					return "", l.syntaxError(`expected '"' ending but EOF encountered`)
+				}
+				if _, err := hex.Decode(x[:], l.b[i+1:i+5]); err != nil {
+					return "", err
+				}
+				l.sbuf.WriteRune(rune(x[0])<<8 + rune(x[1]))
+				i += 4
+			}
+			escape = false
+			i++
+			continue
+		}
+		if c == '\\' {
+			escape = true
+			i++
+			continue
+		}
+		if c == '"' {
+			s := l.sbuf.String()
+			l.sbuf.Reset()
+			l.advance(i + 1)
+			return s, nil
+		}
+		if c >= 0x80 {
+			if !utf8.FullRune(l.b[i:]) {
+				return "", l.syntaxError(`expected '"' ending but EOF encountered`)
+			}
+			r, n := utf8.DecodeRune(l.b[i:])
+			l.sbuf.WriteRune(r)
+			i += n
+			continue
+		}
+		l.sbuf.WriteByte(c)
+		i++
+	}
+	return "", l.syntaxError(`expected '"' ending but EOF encountered`)
+}
+
+func (l *SliceLexer) StringValue(expected string) error {
+	s, err := l.String()
+	if err != nil {
+		return err
+	}
+	if s != expected {
+		return l.syntaxError("expected string %q but got %q", expected, s)
+	}
+	return nil
+}
+
+func (l *SliceLexer) Skip() error {
+	b, err := l.nonSpaceByte()
+	if err != nil {
+		return err
+	}
+	switch b {
+	default:
+		return l.syntaxError("unexpected byte %q", b)
+	case '[':
+		return l.skipArray()
+	case '{':
+		return l.skipDict()
+	case '"':
+		_, err := l.String()
+		return err
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		_, err := l.Float64()
+		return err
+	case 't', 'f':
+		_, err := l.Bool()
+		return err
+	case 'n':
+		return l.Null()
+	}
+}
+
+func (l *SliceLexer) skipArray() error {
+	if err := l.Delim('['); err != nil {
+		return err
+	}
+	for {
+		more, err := l.More()
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+		if err := l.Skip(); err != nil {
+			return err
+		}
+	}
+	return l.Delim(']')
+}
+
+func (l *SliceLexer) skipDict() error {
+	if err := l.Delim('{'); err != nil {
+		return err
+	}
+	for {
+		more, err := l.More()
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+		if err := l.Skip(); err != nil {
+			return err
+		}
+		if err := l.Delim(':'); err != nil {
+			return err
+		}
+		if err := l.Skip(); err != nil {
+			return err
+		}
+	}
+	return l.Delim('}')
+}
+
+func (l *SliceLexer) nonSpaceByte() (byte, error) {
+	for len(l.b) > 0 {
+		b := l.b[0]
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, nil
+		}
+		l.advance(1)
+	}
+	return 0, io.EOF
+}
+
+// bytesToString converts b to a string without copying. The caller
+// must not mutate b (or the underlying array of the slice it came
+// from) while the returned string is in use.
+func bytesToString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
@@ -0,0 +1,222 @@
+// Copyright 2017 Łukasz Pankowski <lukpank at o2 dot pl>. All rights
+// reserved.  This source code is licensed under the terms of the MIT
+// license. See LICENSE file for details.
+
+package jsonlexer_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lukpank/jsonlexer"
+)
+
+func TestSliceLexerArray(t *testing.T) {
+	l := jsonlexer.NewSlice([]byte(" [\r\n123, -84\t]"))
+	if err := l.Delim('['); err != nil {
+		t.Fatalf("expected '[' but got error: %v", err)
+	}
+	expectedSliceMore(t, l)
+	expectedSliceInt64(t, l, 123)
+	expectedSliceMore(t, l)
+	expectedSliceInt64(t, l, -84)
+	if err := l.Delim(']'); err != nil {
+		t.Fatalf("expected ']' but got error: %v", err)
+	}
+}
+
+func TestSliceLexerFloat64(t *testing.T) {
+	l := jsonlexer.NewSlice([]byte("-1.5"))
+	got, err := l.Float64()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != -1.5 {
+		t.Errorf("expected -1.5 but got %g", got)
+	}
+}
+
+func TestSliceLexerBool(t *testing.T) {
+	l := jsonlexer.NewSlice([]byte("true"))
+	got, err := l.Bool()
+	if err != nil || !got {
+		t.Fatalf("expected true but got %v, %v", got, err)
+	}
+}
+
+func TestSliceLexerString(t *testing.T) {
+	cases := []struct{ input, output string }{
+		{`"test"`, "test"},
+		{`"test\bąę\f\n\r\t"`, "test\bąę\f\n\r\t"},
+	}
+	for _, c := range cases {
+		for _, unsafeMode := range []bool{false, true} {
+			l := jsonlexer.NewSlice([]byte(c.input))
+			l.Unsafe = unsafeMode
+			got, err := l.String()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != c.output {
+				t.Errorf("expected %q but got %q", c.output, got)
+			}
+		}
+	}
+}
+
+func TestSliceLexerStringCopySurvivesMutation(t *testing.T) {
+	b := []byte(`"test"`)
+	l := jsonlexer.NewSlice(b)
+	l.Unsafe = true
+	got, err := l.StringCopy()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := range b {
+		b[i] = 'x'
+	}
+	if got != "test" {
+		t.Errorf("expected StringCopy result to survive mutation, got %q", got)
+	}
+}
+
+func TestSliceLexerStringValue(t *testing.T) {
+	l := jsonlexer.NewSlice([]byte(`"test"`))
+	if err := l.StringValue("test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	l = jsonlexer.NewSlice([]byte(`"test"`))
+	if err := l.StringValue("other"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestSliceLexerSkip(t *testing.T) {
+	l := jsonlexer.NewSlice([]byte(`[1, "a", true, [1,2], {"a":1}]`))
+	if err := l.Delim('['); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		expectedSliceMore(t, l)
+		if err := l.Skip(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := l.Delim(']'); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSliceLexerSyntaxErrorOffsetAndPath(t *testing.T) {
+	l := jsonlexer.NewSlice([]byte(`{"users": [{}, {}, {"email": 123}]}`))
+	err := l.ForEachField(func(key []byte) error {
+		if string(key) != "users" {
+			return l.Skip()
+		}
+		if err := l.Delim('['); err != nil {
+			return err
+		}
+		for {
+			more, err := l.More()
+			if err != nil {
+				return err
+			}
+			if !more {
+				break
+			}
+			if err := l.ForEachField(func(key []byte) error {
+				if string(key) != "email" {
+					return l.Skip()
+				}
+				_, err := l.String()
+				return err
+			}); err != nil {
+				return err
+			}
+		}
+		return l.Delim(']')
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	se, ok := err.(*jsonlexer.SyntaxError)
+	if !ok {
+		t.Fatalf("expected a *jsonlexer.SyntaxError, got %T: %v", err, err)
+	}
+	if se.Path != ".users[2].email" {
+		t.Errorf("got path %q", se.Path)
+	}
+	const wantOffset = int64(len(`{"users": [{}, {}, {"email": `))
+	if se.Offset != wantOffset {
+		t.Errorf("got offset %d, want %d", se.Offset, wantOffset)
+	}
+}
+
+func TestSliceLexerSyntaxErrorTopLevel(t *testing.T) {
+	l := jsonlexer.NewSlice([]byte(`nope`))
+	_, err := l.Int64()
+	se, ok := err.(*jsonlexer.SyntaxError)
+	if !ok {
+		t.Fatalf("expected a *jsonlexer.SyntaxError, got %T: %v", err, err)
+	}
+	if se.Path != "" {
+		t.Errorf("got path %q, want empty at the top level", se.Path)
+	}
+	if se.Offset != 0 {
+		t.Errorf("got offset %d, want 0", se.Offset)
+	}
+}
+
+func expectedSliceMore(t *testing.T, l *jsonlexer.SliceLexer) {
+	t.Helper()
+	more, err := l.More()
+	if err != nil {
+		t.Fatalf("expected more but got error: %v", err)
+	}
+	if !more {
+		t.Fatal("expected more but got false")
+	}
+}
+
+func expectedSliceInt64(t *testing.T, l *jsonlexer.SliceLexer, expected int64) {
+	t.Helper()
+	got, err := l.Int64()
+	if err != nil {
+		t.Fatalf("expected %d but got error: %v", expected, err)
+	}
+	if got != expected {
+		t.Errorf("expected %d but got: %d", expected, got)
+	}
+}
+
+const benchArray = `[1,2,3,4,5,6,7,8,9,10,"alpha","beta","gamma","delta",true,false,1.5,2.25]`
+
+func BenchmarkLexerArray(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		l := jsonlexer.New(strings.NewReader(benchArray))
+		if err := l.Skip(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSliceLexerArray(b *testing.B) {
+	buf := []byte(benchArray)
+	for i := 0; i < b.N; i++ {
+		l := jsonlexer.NewSlice(buf)
+		if err := l.Skip(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSliceLexerArrayUnsafe(b *testing.B) {
+	buf := []byte(benchArray)
+	for i := 0; i < b.N; i++ {
+		l := jsonlexer.NewSlice(buf)
+		l.Unsafe = true
+		if err := l.Skip(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright 2017 Łukasz Pankowski <lukpank at o2 dot pl>. All rights
+// reserved.  This source code is licensed under the terms of the MIT
+// license. See LICENSE file for details.
+
+package jsonlexer
+
+import (
+	"io"
+)
+
+// Type identifies the kind of the next JSON value, as reported by
+// TokenType.
+type Type int
+
+const (
+	TypeNull Type = iota
+	TypeBool
+	TypeNumber
+	TypeString
+	TypeArrayStart
+	TypeObjectStart
+)
+
+// TokenType peeks the next non-space byte and reports the type of the
+// value it starts, without consuming any input. It is the primitive
+// that lets a caller decode sum types or heterogeneous arrays without
+// a look-ahead of its own.
+func (l *Lexer) TokenType() (Type, error) {
+	b, err := l.Peek()
+	if err != nil {
+		return 0, err
+	}
+	switch b {
+	case 'n':
+		return TypeNull, nil
+	case 't', 'f':
+		return TypeBool, nil
+	case '"':
+		return TypeString, nil
+	case '[':
+		return TypeArrayStart, nil
+	case '{':
+		return TypeObjectStart, nil
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return TypeNumber, nil
+	default:
+		return 0, l.syntaxError("unexpected byte %q", b)
+	}
+}
+
+// Raw reads and returns the exact source bytes (including the original
+// escapes of a string, or the whole span of a nested array or object)
+// of the next JSON value, without decoding it. This is useful for
+// lazy or deferred decoding: the caller can store the RawMessage and
+// decode it later, possibly with a different Lexer.
+//
+// When the value lies entirely within the already-buffered input (the
+// common case), Raw returns a slice of Lexer's internal buffer rather
+// than a copy, so — like SliceLexer's Unsafe mode — the result must
+// not be retained past the next call that advances the lexer; copy it
+// (append([]byte(nil), raw...)) to keep it longer.
+func (l *Lexer) Raw() ([]byte, error) {
+	b, err := l.nonSpaceByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case b == '{' || b == '[':
+		return l.rawContainer()
+	case b == '"':
+		return l.rawString()
+	case b == 't':
+		return l.rawLiteral("true")
+	case b == 'f':
+		return l.rawLiteral("false")
+	case b == 'n':
+		return l.rawLiteral("null")
+	case b == '-' || b >= '0' && b <= '9':
+		return l.rawNumber()
+	default:
+		return nil, l.syntaxError("unexpected byte %q", b)
+	}
+}
+
+// rawContainer returns an entire array or object, tracking nesting
+// depth and string escapes so that '{', '}', '[', ']' occurring inside
+// string values do not confuse it. It is called with l.b[0] holding
+// the opening '{' or '['.
+func (l *Lexer) rawContainer() ([]byte, error) {
+	depth := 0
+	inString := false
+	escape := false
+	for i, b := range l.b {
+		if inString {
+			switch {
+			case escape:
+				escape = false
+			case b == '\\':
+				escape = true
+			case b == '"':
+				inString = false
+			}
+			continue
+		}
+		switch b {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				j := i + 1
+				raw := l.b[:j]
+				l.advance(j)
+				return raw, nil
+			}
+		}
+	}
+	// The closing delimiter lies past the buffered window: this value
+	// straddles a refill, so fall back to accumulating it byte by byte.
+	l.sbuf.Reset()
+	l.sbuf.Write(l.b)
+	l.advance(len(l.b))
+	for {
+		b, ok, err := l.takeRawByte()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, l.syntaxError("unexpected EOF while reading raw value")
+		}
+		l.sbuf.WriteByte(b)
+		if inString {
+			switch {
+			case escape:
+				escape = false
+			case b == '\\':
+				escape = true
+			case b == '"':
+				inString = false
+			}
+			continue
+		}
+		switch b {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return l.sbuf.Bytes(), nil
+			}
+		}
+	}
+}
+
+// rawString is called with l.b[0] holding the opening '"'.
+func (l *Lexer) rawString() ([]byte, error) {
+	escape := false
+	for i := 1; i < len(l.b); i++ {
+		b := l.b[i]
+		switch {
+		case escape:
+			escape = false
+		case b == '\\':
+			escape = true
+		case b == '"':
+			j := i + 1
+			raw := l.b[:j]
+			l.advance(j)
+			return raw, nil
+		}
+	}
+	l.sbuf.Reset()
+	l.sbuf.Write(l.b)
+	l.advance(len(l.b))
+	for {
+		b, ok, err := l.takeRawByte()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, l.syntaxError(`expected '"' ending but EOF encountered`)
+		}
+		l.sbuf.WriteByte(b)
+		switch {
+		case escape:
+			escape = false
+		case b == '\\':
+			escape = true
+		case b == '"':
+			return l.sbuf.Bytes(), nil
+		}
+	}
+}
+
+// rawNumber is bounded by maxNumberLen for the same reason scanNumber
+// is: without a cap, a malformed, never-terminated number literal
+// would make Raw buffer unbounded memory.
+func (l *Lexer) rawNumber() ([]byte, error) {
+	i := 0
+	for ; i < len(l.b); i++ {
+		if !isNumberByte(l.b[i]) {
+			break
+		}
+		if i >= maxNumberLen {
+			return nil, l.syntaxError("number literal too long (over %d bytes)", maxNumberLen)
+		}
+	}
+	if i < len(l.b) {
+		raw := l.b[:i]
+		l.advance(i)
+		return raw, nil
+	}
+	// The number's end lies past the buffered window: it straddles a
+	// refill, so fall back to accumulating it byte by byte.
+	l.sbuf.Reset()
+	l.sbuf.Write(l.b)
+	l.advance(len(l.b))
+	for {
+		b, ok, err := l.peekRawByte()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || !isNumberByte(b) {
+			return l.sbuf.Bytes(), nil
+		}
+		if l.sbuf.Len() >= maxNumberLen {
+			return nil, l.syntaxError("number literal too long (over %d bytes)", maxNumberLen)
+		}
+		l.advance(1)
+		l.sbuf.WriteByte(b)
+	}
+}
+
+func isNumberByte(b byte) bool {
+	return b >= '0' && b <= '9' || b == '-' || b == '+' || b == '.' || b == 'e' || b == 'E'
+}
+
+// rawLiteral is called with l.b[0] holding the first byte of s ("true",
+// "false" or "null").
+func (l *Lexer) rawLiteral(s string) ([]byte, error) {
+	if len(l.b) >= len(s) {
+		if string(l.b[:len(s)]) == s {
+			raw := l.b[:len(s)]
+			l.advance(len(s))
+			return raw, nil
+		}
+		return nil, l.syntaxError("expected %q", s)
+	}
+	l.sbuf.Reset()
+	l.sbuf.Write(l.b)
+	l.advance(len(l.b))
+	for l.sbuf.Len() < len(s) {
+		b, ok, err := l.takeRawByte()
+		if err != nil {
+			return nil, err
+		}
+		if !ok || b != s[l.sbuf.Len()] {
+			return nil, l.syntaxError("expected %q", s)
+		}
+		l.sbuf.WriteByte(b)
+	}
+	return l.sbuf.Bytes(), nil
+}
+
+// peekRawByte returns the next byte without consuming it and without
+// skipping whitespace. ok is false (with a nil error) at EOF.
+func (l *Lexer) peekRawByte() (b byte, ok bool, err error) {
+	if len(l.b) == 0 {
+		if l.err != nil {
+			if l.err == io.EOF {
+				return 0, false, nil
+			}
+			return 0, false, l.err
+		}
+		var n int
+		n, l.err = l.r.Read(l.buf[:])
+		if n == 0 {
+			if l.err == io.EOF {
+				return 0, false, nil
+			}
+			if l.err != nil {
+				return 0, false, l.err
+			}
+		}
+		l.b = l.buf[:n]
+	}
+	if len(l.b) == 0 {
+		return 0, false, nil
+	}
+	return l.b[0], true, nil
+}
+
+func (l *Lexer) takeRawByte() (b byte, ok bool, err error) {
+	b, ok, err = l.peekRawByte()
+	if ok {
+		l.advance(1)
+	}
+	return b, ok, err
+}
@@ -0,0 +1,173 @@
+// Copyright 2017 Łukasz Pankowski <lukpank at o2 dot pl>. All rights
+// reserved.  This source code is licensed under the terms of the MIT
+// license. See LICENSE file for details.
+
+package jsonlexer_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lukpank/jsonlexer"
+)
+
+func TestLexerNull(t *testing.T) {
+	r := &readers{S: " \r\n null"}
+	for i := 0; i < 2*r.Len(); i++ {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			l := jsonlexer.New(r.Get(i))
+			if err := l.Null(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLexerSkipNull(t *testing.T) {
+	l := jsonlexer.New(strings.NewReader(" [null, 1, null]"))
+	if err := l.Delim('['); err != nil {
+		t.Fatal(err)
+	}
+	expectedMore(t, l)
+	if err := l.Skip(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedMore(t, l)
+	expectedInt64(t, l, 1)
+	expectedMore(t, l)
+	if err := l.Skip(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := l.Delim(']'); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLexerTokenType(t *testing.T) {
+	cases := []struct {
+		s    string
+		want jsonlexer.Type
+	}{
+		{"null", jsonlexer.TypeNull},
+		{"true", jsonlexer.TypeBool},
+		{"false", jsonlexer.TypeBool},
+		{"-1.5", jsonlexer.TypeNumber},
+		{`"s"`, jsonlexer.TypeString},
+		{"[1]", jsonlexer.TypeArrayStart},
+		{`{"a":1}`, jsonlexer.TypeObjectStart},
+	}
+	for _, c := range cases {
+		t.Run(c.s, func(t *testing.T) {
+			l := jsonlexer.New(strings.NewReader(c.s))
+			got, err := l.TokenType()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != c.want {
+				t.Errorf("got %v, want %v", got, c.want)
+			}
+			// TokenType must not consume the peeked byte.
+			if err := l.Skip(); err != nil {
+				t.Fatalf("Skip after TokenType: %v", err)
+			}
+		})
+	}
+}
+
+func TestLexerRaw(t *testing.T) {
+	cases := []string{
+		`123`,
+		`-1.5e3`,
+		`"a\nbą"`,
+		`[1, 2, [3, "]"], {"a": "}"}]`,
+		`{"a": 1, "b": [true, false, null]}`,
+		"null",
+		"true",
+	}
+	for _, c := range cases {
+		r := &readers{S: c}
+		for i := 0; i < 2*r.Len(); i++ {
+			t.Run(fmt.Sprintf("%s/%d", c, i), func(t *testing.T) {
+				l := jsonlexer.New(r.Get(i))
+				got, err := l.Raw()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if string(got) != c {
+					t.Errorf("got %q, want %q", got, c)
+				}
+			})
+		}
+	}
+}
+
+func TestLexerRawThenContinue(t *testing.T) {
+	l := jsonlexer.New(strings.NewReader(`[{"a": [1,2]}, 42]`))
+	if err := l.Delim('['); err != nil {
+		t.Fatal(err)
+	}
+	expectedMore(t, l)
+	got, err := l.Raw()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != `{"a": [1,2]}` {
+		t.Fatalf("got %q", got)
+	}
+	expectedMore(t, l)
+	expectedInt64(t, l, 42)
+	if err := l.Delim(']'); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLexerRawTooLong(t *testing.T) {
+	s := "[" + strings.Repeat("9", 4096+100) + ",1]"
+	l := jsonlexer.New(strings.NewReader(s))
+	if err := l.Delim('['); err != nil {
+		t.Fatal(err)
+	}
+	expectedMore(t, l)
+	if _, err := l.Raw(); err == nil {
+		t.Fatal("expected a clear \"too long\" error for a genuinely oversized literal")
+	} else if !strings.Contains(err.Error(), "too long") {
+		t.Fatalf("expected a clear too-long error, got: %v", err)
+	}
+}
+
+func TestSliceLexerNullAndTokenType(t *testing.T) {
+	l := jsonlexer.NewSlice([]byte("null"))
+	typ, err := l.TokenType()
+	if err != nil || typ != jsonlexer.TypeNull {
+		t.Fatalf("got %v, %v", typ, err)
+	}
+	if err := l.Null(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSliceLexerRaw(t *testing.T) {
+	l := jsonlexer.NewSlice([]byte(`[1, {"a": [2, 3]}, "x"]`))
+	if err := l.Delim('['); err != nil {
+		t.Fatal(err)
+	}
+	expectedSliceMore(t, l)
+	expectedSliceInt64(t, l, 1)
+	expectedSliceMore(t, l)
+	got, err := l.Raw()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != `{"a": [2, 3]}` {
+		t.Fatalf("got %q", got)
+	}
+	expectedSliceMore(t, l)
+	s, err := l.String()
+	if err != nil || s != "x" {
+		t.Fatalf("got %q, %v", s, err)
+	}
+	if err := l.Delim(']'); err != nil {
+		t.Fatal(err)
+	}
+}